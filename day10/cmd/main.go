@@ -1,42 +1,68 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"log"
+	"math/big"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
 func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
-}
+	gapsText := flag.String("gaps", "1,2,3", "comma separated joltage differences allowed between adapters")
+	list := flag.Int("list", 0, "print the first N arrangements of adapters")
+	flag.Parse()
 
-func part1(reader io.Reader) int {
-	adapters := loadData(reader)
-
-	currentJoltage := 0
-	num1Diff := 0
-	num3Diff := 1 // the last jump to our device is always a 3 so start at 1
-	for _, a := range adapters {
-		diff := a - currentJoltage
-		currentJoltage = a
-		if diff == 1 {
-			num1Diff++
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	gaps, err := parseGaps(*gapsText)
+	common.MustNotError(err)
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+
+	a := newAnalyzer(loadData(file), gaps)
+
+	// some arrangements may still connect when the full chain doesn't
+	if hist, err := a.histogram(); err != nil {
+		fmt.Printf("Part 1: %v\n", err)
+	} else {
+		for _, gap := range sortedKeys(hist) {
+			fmt.Printf("%d-jolt differences: %d\n", gap, hist[gap])
+		}
+		fmt.Println()
+		if a.gaps[1] && a.gaps[3] {
+			fmt.Printf("Part 1: %d\n", hist[1]*hist[3])
 		}
-		if diff == 3 {
-			num3Diff++
+	}
+	fmt.Printf("Part 2: %s\n", a.countArrangements())
+
+	it := a.arrangements()
+	for i := 0; i < *list; i++ {
+		arrangement, ok := it.next()
+		if !ok {
+			break
 		}
+		fmt.Println(arrangement)
 	}
+}
 
-	return num1Diff * num3Diff
+func part1(reader io.Reader) int {
+	hist, err := newAnalyzer(loadData(reader), []int{1, 2, 3}).histogram()
+	common.MustNotError(err)
+	return hist[1] * hist[3]
 }
 
-func part2(reader io.Reader) int {
-	adapters := loadData(reader)
-	return countPermutations(adapters, 0)
+func part2(reader io.Reader) *big.Int {
+	return newAnalyzer(loadData(reader), []int{1, 2, 3}).countArrangements()
 }
 
 // return sorted list
@@ -51,31 +77,153 @@ func loadData(reader io.Reader) []int {
 	return adapters
 }
 
-var cache = make(map[int]int)
+// Parses a list of allowed joltage differences such as "1,2,3"
+func parseGaps(text string) ([]int, error) {
+	var gaps []int
+	for _, field := range strings.Split(text, ",") {
+		gap, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("bad joltage difference %q", field)
+		}
+		if gap <= 0 {
+			return nil, fmt.Errorf("joltage differences must be positive, got %d", gap)
+		}
+		gaps = append(gaps, gap)
+	}
+	return gaps, nil
+}
 
-func countPermutations(a []int, last int) int {
-	if len(a) == 0 {
-		return 1
+// Analyzes chains of adapters from the charging outlet (0 jolts) to the device
+//
+// The device's joltage is the highest adapter plus the largest allowed difference
+type analyzer struct {
+	chain  []int        // outlet, sorted adapters, device
+	gaps   map[int]bool // the allowed joltage differences
+	maxGap int
+}
+
+func newAnalyzer(adapters []int, gaps []int) *analyzer {
+	a := &analyzer{gaps: make(map[int]bool)}
+	for _, gap := range gaps {
+		a.gaps[gap] = true
+		if gap > a.maxGap {
+			a.maxGap = gap
+		}
 	}
 
-	if v, ok := cache[last]; ok {
-		return v
+	sorted := append([]int(nil), adapters...)
+	sort.Ints(sorted)
+	device := a.maxGap
+	if len(sorted) > 0 {
+		device += sorted[len(sorted)-1]
 	}
 
-	count := 0
-	max := len(a)
-	if max > 3 {
-		max = 3
+	a.chain = append([]int{0}, sorted...)
+	a.chain = append(a.chain, device)
+	return a
+}
+
+// Counts the joltage differences of the chain that uses every adapter
+//
+// It is an error if the chain has a difference that is not allowed
+func (a *analyzer) histogram() (map[int]int, error) {
+	hist := make(map[int]int)
+	for i := 1; i < len(a.chain); i++ {
+		gap := a.chain[i] - a.chain[i-1]
+		if !a.gaps[gap] {
+			return nil, fmt.Errorf("can't use every adapter: %d jolts to %d jolts is not an allowed difference", a.chain[i-1], a.chain[i])
+		}
+		hist[gap]++
 	}
+	return hist, nil
+}
 
-	for i := 0; i < max; i++ {
-		diff := a[i] - last
-		if diff > 3 {
-			break
+// Counts the ways to reach the device from each point in the chain
+func (a *analyzer) waysToDevice() []*big.Int {
+	ways := make([]*big.Int, len(a.chain))
+	last := len(a.chain) - 1
+	ways[last] = big.NewInt(1)
+	for i := last - 1; i >= 0; i-- {
+		ways[i] = new(big.Int)
+		for j := i + 1; j <= last && a.chain[j]-a.chain[i] <= a.maxGap; j++ {
+			if a.gaps[a.chain[j]-a.chain[i]] {
+				ways[i].Add(ways[i], ways[j])
+			}
 		}
-		count += countPermutations(a[i+1:], a[i])
+	}
+	return ways
+}
+
+// Counts the distinct arrangements of adapters that connect the outlet to the device
+func (a *analyzer) countArrangements() *big.Int {
+	return a.waysToDevice()[0]
+}
+
+// Lazily enumerates the arrangements of adapters in lexicographic order
+type arrangementIterator struct {
+	a       *analyzer
+	live    []bool // whether the device can be reached from each point in the chain
+	path    []int  // chain indices of the arrangement being built
+	tries   []int  // for each point in the path, the next chain index to try
+	started bool
+}
+
+func (a *analyzer) arrangements() *arrangementIterator {
+	ways := a.waysToDevice()
+	live := make([]bool, len(ways))
+	for i, w := range ways {
+		live[i] = w.Sign() > 0
+	}
+	return &arrangementIterator{a: a, live: live}
+}
+
+// Finds the next arrangement, returning the joltages of the adapters it uses
+func (it *arrangementIterator) next() ([]int, bool) {
+	chain := it.a.chain
+	if !it.started {
+		it.started = true
+		if !it.live[0] {
+			return nil, false
+		}
+		it.path = []int{0}
+		it.tries = []int{1}
 	}
 
-	cache[last] = count
-	return count
+	for len(it.path) > 0 {
+		depth := len(it.path) - 1
+		i := it.path[depth]
+
+		// Reached the device, emit the adapters between the outlet and the device
+		if i == len(chain)-1 {
+			arrangement := make([]int, 0, len(it.path)-2)
+			for _, p := range it.path[1:depth] {
+				arrangement = append(arrangement, chain[p])
+			}
+			it.path, it.tries = it.path[:depth], it.tries[:depth]
+			return arrangement, true
+		}
+
+		j := it.tries[depth]
+		if j >= len(chain) || chain[j]-chain[i] > it.a.maxGap {
+			it.path, it.tries = it.path[:depth], it.tries[:depth]
+			continue
+		}
+		it.tries[depth]++
+
+		if it.a.gaps[chain[j]-chain[i]] && it.live[j] {
+			it.path = append(it.path, j)
+			it.tries = append(it.tries, j+1)
+		}
+	}
+
+	return nil, false
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
 }
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"fmt"
+	"math/big"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -23,8 +26,8 @@ func TestPart2(t *testing.T) {
 	t.Parallel()
 	reader := bufio.NewReader(openTestInput(t))
 	got := part2(reader)
-	want := part2Answer
-	if want != got {
+	want := big.NewInt(part2Answer)
+	if want.Cmp(got) != 0 {
 		t.Errorf("expected %d got %d\n", want, got)
 	}
 }
@@ -37,3 +40,88 @@ func openTestInput(t *testing.T) *os.File {
 
 	return file
 }
+
+const example1 = `16
+10
+15
+5
+1
+11
+7
+19
+6
+12
+4`
+
+func TestArrangements(t *testing.T) {
+	t.Parallel()
+	a := newAnalyzer(loadData(strings.NewReader(example1)), []int{1, 2, 3})
+
+	hist, err := a.histogram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hist[1] != 7 || hist[3] != 5 || len(hist) != 2 {
+		t.Errorf("expected 7 1-jolt and 5 3-jolt differences got %v\n", hist)
+	}
+
+	if got := a.countArrangements(); got.Cmp(big.NewInt(8)) != 0 {
+		t.Errorf("expected 8 arrangements got %s\n", got)
+	}
+
+	want := []string{
+		"[1 4 5 6 7 10 11 12 15 16 19]",
+		"[1 4 5 6 7 10 12 15 16 19]",
+		"[1 4 5 7 10 11 12 15 16 19]",
+		"[1 4 5 7 10 12 15 16 19]",
+		"[1 4 6 7 10 11 12 15 16 19]",
+		"[1 4 6 7 10 12 15 16 19]",
+		"[1 4 7 10 11 12 15 16 19]",
+		"[1 4 7 10 12 15 16 19]",
+	}
+	it := a.arrangements()
+	for i, w := range want {
+		got, ok := it.next()
+		if !ok || fmt.Sprint(got) != w {
+			t.Fatalf("arrangement %d: expected %s got %v\n", i+1, w, got)
+		}
+	}
+	if got, ok := it.next(); ok {
+		t.Errorf("expected no more arrangements got %v\n", got)
+	}
+}
+
+func TestCustomGaps(t *testing.T) {
+	t.Parallel()
+	a := newAnalyzer([]int{1, 3, 4, 6, 9}, []int{1, 3, 5})
+
+	hist, err := a.histogram()
+	if err == nil {
+		t.Errorf("expected an error for a 2-jolt difference got %v\n", hist)
+	}
+
+	// 0 -> 1 -> 4 -> 9 -> 14, 0 -> 1 -> 6 -> 9 -> 14, 0 -> 3 -> 4 -> 9 -> 14, ...
+	count := 0
+	it := a.arrangements()
+	for _, ok := it.next(); ok; _, ok = it.next() {
+		count++
+	}
+	if got := a.countArrangements(); !got.IsInt64() || got.Int64() != int64(count) {
+		t.Errorf("expected %d arrangements got %s\n", count, got)
+	}
+}
+
+func TestBigCounts(t *testing.T) {
+	t.Parallel()
+	var adapters []int
+	for i := 1; i <= 200; i++ {
+		adapters = append(adapters, i)
+	}
+
+	// with every joltage available, the counts follow the tribonacci numbers
+	got := newAnalyzer(adapters, []int{1, 2, 3}).countArrangements()
+	want, _ := new(big.Int).SetString("52622583840983769603765180599790256716084480555530641", 10)
+	if got.Cmp(want) != 0 {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"log"
+	"os"
 	"strings"
+	"sync"
 
 	common "github.com/torbensky/adventofcode-common"
 )
@@ -11,12 +15,6 @@ import (
 type cell = byte
 type coord []int
 
-const (
-	floor    cell = '.'
-	empty    cell = 'L'
-	occupied cell = '#'
-)
-
 var vectors = []coord{
 	{1, 1},
 	{1, -1},
@@ -28,9 +26,79 @@ var vectors = []coord{
 	{0, -1},
 }
 
+// The characters used for each kind of cell in the seat map
+type alphabet struct {
+	floor    cell
+	empty    cell
+	occupied cell
+}
+
+var defaultAlphabet = alphabet{floor: '.', empty: 'L', occupied: '#'}
+
+// How seats find their neighbours
+type neighbourMode int
+
+const (
+	adjacent    neighbourMode = iota // the 8 seats around a seat
+	lineOfSight                      // the first seat seen in each of the 8 directions
+)
+
+// Describes how people choose seats
+type ruleSet struct {
+	mode      neighbourMode
+	tolerance int // people leave an occupied seat when at least this many neighbours are occupied
+	maxSight  int // how far people can see in line of sight mode, 0 means no limit
+	cells     alphabet
+}
+
+var (
+	part1Rules = ruleSet{mode: adjacent, tolerance: 4, cells: defaultAlphabet}
+	part2Rules = ruleSet{mode: lineOfSight, tolerance: 5, cells: defaultAlphabet}
+)
+
 func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
+	mode := flag.String("mode", "", "run a custom simulation with the neighbour mode \"adjacent\" or \"sight\"")
+	tolerance := flag.Int("tolerance", 4, "occupied seats empty when at least this many neighbours are occupied")
+	maxSight := flag.Int("sight", 0, "how far people can see in sight mode, 0 means no limit")
+	cells := flag.String("cells", ".L#", "the characters used for floor, empty seats and occupied seats")
+	maxRounds := flag.Int("rounds", 10000, "give up after this many rounds")
+	workers := flag.Int("workers", 1, "split each round across this many goroutines")
+	flag.Parse()
+
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+
+	if *mode == "" {
+		grid := loadGrid(file)
+		fmt.Printf("Part 1: %d\n", mustRun(grid, part1Rules, *maxRounds, *workers).final())
+		fmt.Printf("Part 2: %d\n", mustRun(grid, part2Rules, *maxRounds, *workers).final())
+		return
+	}
+
+	rules := ruleSet{tolerance: *tolerance, maxSight: *maxSight}
+	switch *mode {
+	case "adjacent":
+		rules.mode = adjacent
+	case "sight":
+		rules.mode = lineOfSight
+	default:
+		log.Fatalf("unknown neighbour mode %q", *mode)
+	}
+	if len(*cells) != 3 {
+		log.Fatal("the cell alphabet needs exactly 3 characters")
+	}
+	rules.cells = alphabet{floor: (*cells)[0], empty: (*cells)[1], occupied: (*cells)[2]}
+
+	result := mustRun(loadGrid(file), rules, *maxRounds, *workers)
+	for round, count := range result.occupancy {
+		fmt.Printf("Round %d: %d occupied\n", round, count)
+	}
+	fmt.Println(result)
 }
 
 func loadGrid(reader io.Reader) [][]cell {
@@ -42,165 +110,249 @@ func loadGrid(reader io.Reader) [][]cell {
 	return grid
 }
 
+func copyGrid(grid [][]cell) [][]cell {
+	c := make([][]cell, len(grid))
+	for y := range grid {
+		c[y] = append([]cell(nil), grid[y]...)
+	}
+	return c
+}
+
 func part1(reader io.Reader) int {
-	grid := loadGrid(reader)
-	for {
-		stable := simulate(grid)
-		if stable {
-			break
-		}
+	return mustRun(loadGrid(reader), part1Rules, 10000, 1).final()
+}
+
+func part2(reader io.Reader) int {
+	return mustRun(loadGrid(reader), part2Rules, 10000, 1).final()
+}
+
+func mustRun(grid [][]cell, rules ruleSet, maxRounds, workers int) outcome {
+	sim, err := newSimulation(grid, rules)
+	common.MustNotError(err)
+	sim.workers = workers
+	result, err := sim.run(maxRounds)
+	common.MustNotError(err)
+	return result
+}
+
+// The result of running a simulation
+type outcome struct {
+	rounds      int   // rounds run until the seats stabilized (or the cycle was found)
+	cycleStart  int   // the first round of the repeating cycle
+	cycleLength int   // 1 when the seats stabilized, more when they oscillate
+	occupancy   []int // occupied seats after each round, starting with the initial seat map
+}
+
+// The number of occupied seats once the simulation settled
+func (o outcome) final() int {
+	return o.occupancy[len(o.occupancy)-1]
+}
+
+func (o outcome) String() string {
+	if o.cycleLength == 1 {
+		return fmt.Sprintf("stabilized after %d rounds with %d occupied seats", o.rounds, o.final())
 	}
+	return fmt.Sprintf("oscillating every %d rounds from round %d", o.cycleLength, o.cycleStart)
+}
 
-	return countOccupied(grid)
+// Simulates people filling a seat map
+//
+// Floor never changes, so the neighbours of every seat are found once up front and stored as a compact
+// adjacency list. Each round is then a pass over those lists, double buffering the occupancy of the seats.
+type simulation struct {
+	rules      ruleSet
+	grid       [][]cell // the initial seat map
+	seats      []coord  // position of each seat
+	rowStart   []int    // index of the first seat on each row, plus the total number of seats
+	offsets    []int32  // the neighbours of seat i are neighbours[offsets[i]:offsets[i+1]]
+	neighbours []int32
+	occupied   []uint8 // the current round, 1 for an occupied seat
+	next       []uint8 // the buffer the next round is written to
+	workers    int     // number of goroutines each round is split across, by bands of rows
 }
 
-func simulate(grid [][]cell) bool {
-	gridChanged := false
-	var swaps []coord
-	for y := 0; y < len(grid); y++ {
-		for x := 0; x < len(grid[y]); x++ {
-			switch grid[y][x] {
-			case floor:
-				// nothing
-			case empty:
-				if countAdjacent(grid, y, x, occupied) == 0 {
-					gridChanged = true
-					swaps = append(swaps, []int{y, x})
-				}
-			case occupied:
-				if countAdjacent(grid, y, x, occupied) >= 4 {
-					gridChanged = true
-					swaps = append(swaps, []int{y, x})
+func newSimulation(grid [][]cell, rules ruleSet) (*simulation, error) {
+	if rules.tolerance < 1 {
+		return nil, fmt.Errorf("the tolerance needs to be at least 1, got %d", rules.tolerance)
+	}
+	c := rules.cells
+	if c.floor == c.empty || c.floor == c.occupied || c.empty == c.occupied {
+		return nil, fmt.Errorf("the cell alphabet %q needs 3 distinct characters", []byte{c.floor, c.empty, c.occupied})
+	}
+
+	s := &simulation{rules: rules, grid: grid, workers: 1}
+
+	// Number the seats
+	index := make([][]int32, len(grid))
+	for y, row := range grid {
+		s.rowStart = append(s.rowStart, len(s.seats))
+		index[y] = make([]int32, len(row))
+		for x, v := range row {
+			switch v {
+			case c.floor:
+				index[y][x] = -1
+			case c.empty, c.occupied:
+				index[y][x] = int32(len(s.seats))
+				s.seats = append(s.seats, coord{y, x})
+				s.occupied = append(s.occupied, 0)
+				if v == c.occupied {
+					s.occupied[len(s.occupied)-1] = 1
 				}
+			default:
+				return nil, fmt.Errorf("unknown cell %q at row %d column %d", v, y+1, x+1)
 			}
 		}
 	}
-
-	for _, coord := range swaps {
-		swapOccupancy(grid, coord[0], coord[1])
+	s.rowStart = append(s.rowStart, len(s.seats))
+	s.next = make([]uint8, len(s.seats))
+
+	// Find the neighbours of each seat
+	s.offsets = make([]int32, 0, len(s.seats)+1)
+	for _, seat := range s.seats {
+		s.offsets = append(s.offsets, int32(len(s.neighbours)))
+		for _, v := range vectors {
+			if y, x, ok := s.firstSeat(seat[0], seat[1], v); ok {
+				s.neighbours = append(s.neighbours, index[y][x])
+			}
+		}
 	}
+	s.offsets = append(s.offsets, int32(len(s.neighbours)))
 
-	return !gridChanged
+	return s, nil
 }
 
-func countAdjacent(grid [][]cell, y, x int, cellType cell) int {
-	matches := 0
+// Follows the vector from a cell, finding the first seat that can be seen
+func (s *simulation) firstSeat(y, x int, vector coord) (int, int, bool) {
+	reach := 1
+	if s.rules.mode == lineOfSight {
+		reach = s.rules.maxSight
+	}
+
+	for dist := 1; reach == 0 || dist <= reach; dist++ {
+
+		// follow the vector!
+		y, x = y+vector[0], x+vector[1]
 
-	for _, v := range vectors {
-		if !isValidCoord(grid, y+v[0], x+v[1]) {
-			continue
+		// Did vector reach end of the room?
+		if !isValidCoord(s.grid, y, x) {
+			return 0, 0, false
 		}
 
-		c := grid[y+v[0]][x+v[1]]
-		if c == cellType {
-			matches++
+		// Did it hit a seat?
+		if s.grid[y][x] != s.rules.cells.floor {
+			return y, x, true
 		}
 	}
 
-	return matches
+	return 0, 0, false
 }
 
-func countOccupied(grid [][]cell) int {
-	count := 0
-	for i := 0; i < len(grid); i++ {
-		for j := 0; j < len(grid[i]); j++ {
-			if grid[i][j] == occupied {
-				count++
+// Runs rounds until the seats stop changing, or start repeating a cycle of states
+func (s *simulation) run(maxRounds int) (outcome, error) {
+	seen := map[string]int{s.key(): 0}
+	result := outcome{occupancy: []int{s.countOccupied()}}
+
+	for round := 1; round <= maxRounds; round++ {
+		s.step()
+		result.occupancy = append(result.occupancy, s.countOccupied())
+
+		key := s.key()
+		if first, ok := seen[key]; ok {
+			result.rounds = round
+			result.cycleStart = first
+			result.cycleLength = round - first
+			if result.cycleLength == 1 {
+				// the last round didn't change anything, so it doesn't count
+				result.rounds--
+				result.occupancy = result.occupancy[:round]
 			}
+			return result, nil
 		}
+		seen[key] = round
 	}
 
-	return count
+	return result, fmt.Errorf("the seats didn't settle after %d rounds", maxRounds)
 }
 
-func part2(reader io.Reader) int {
-	grid := loadGrid(reader)
-	for {
-		stable := simulatePart2(grid)
-		if stable {
-			break
-		}
+// Runs a single round, writing it into the other buffer and swapping the two
+func (s *simulation) step() {
+	workers := s.workers
+	if workers > len(s.grid) {
+		workers = len(s.grid)
 	}
-	return countOccupied(grid)
-}
-
-func simulatePart2(grid [][]cell) bool {
-	gridChanged := false
-	var swaps []coord
-	for y := 0; y < len(grid); y++ {
-		for x := 0; x < len(grid[y]); x++ {
-			switch grid[y][x] {
-			case floor:
-				// nothing
-			case empty:
-				if countAdjacentPart2(grid, y, x, occupied) == 0 {
-					gridChanged = true
-					swaps = append(swaps, []int{y, x})
-				}
-			case occupied:
-				if countAdjacentPart2(grid, y, x, occupied) >= 5 {
-					gridChanged = true
-					swaps = append(swaps, []int{y, x})
-				}
-			}
-		}
+	if workers <= 1 {
+		s.stepSeats(0, len(s.seats))
+		s.occupied, s.next = s.next, s.occupied
+		return
 	}
 
-	for _, coord := range swaps {
-		swapOccupancy(grid, coord[0], coord[1])
+	// Split the rows into bands, one per worker
+	var wg sync.WaitGroup
+	rowsPerBand := (len(s.grid) + workers - 1) / workers
+	for row := 0; row < len(s.grid); row += rowsPerBand {
+		last := row + rowsPerBand
+		if last > len(s.grid) {
+			last = len(s.grid)
+		}
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			s.stepSeats(from, to)
+		}(s.rowStart[row], s.rowStart[last])
 	}
+	wg.Wait()
 
-	return !gridChanged
+	s.occupied, s.next = s.next, s.occupied
 }
 
-func countAdjacentPart2(grid [][]cell, y, x int, cellType cell) int {
-	matches := 0
-
-	for _, v := range vectors {
-		if !isValidCoord(grid, y+v[0], x+v[1]) {
-			continue
-		}
-
-		if doesVectorHit(grid, y, x, v, cellType) {
-			matches++
+// Works out the next round for the seats in [from, to)
+func (s *simulation) stepSeats(from, to int) {
+	for i := from; i < to; i++ {
+		count := s.countNeighbours(i)
+		switch {
+		case s.occupied[i] == 0 && count == 0:
+			s.next[i] = 1
+		case s.occupied[i] == 1 && count >= s.rules.tolerance:
+			s.next[i] = 0
+		default:
+			s.next[i] = s.occupied[i]
 		}
 	}
+}
 
+// Counts the occupied neighbours of a seat
+func (s *simulation) countNeighbours(seat int) int {
+	matches := 0
+	for _, n := range s.neighbours[s.offsets[seat]:s.offsets[seat+1]] {
+		matches += int(s.occupied[n])
+	}
 	return matches
 }
 
-func doesVectorHit(grid [][]cell, y, x int, vector []int, cellType cell) bool {
-	dy, dx := y, x
-	for {
-
-		// follow the vector!
-		dy, dx = dy+vector[0], dx+vector[1]
-
-		// Did vector reach end of the room?
-		if !isValidCoord(grid, dy, dx) {
-			return false
-		}
-
-		gt := grid[dy][dx]
+func (s *simulation) countOccupied() int {
+	count := 0
+	for _, o := range s.occupied {
+		count += int(o)
+	}
 
-		// Did it hit the thing we are looking for?
-		if gt == cellType {
-			return true
-		}
+	return count
+}
 
-		// Did it hit some other non-empty cell?
-		if gt != floor {
-			return false
-		}
-	}
+// A snapshot of the current round, used to find repeated states
+func (s *simulation) key() string {
+	return string(s.occupied)
 }
 
-func swapOccupancy(grid [][]cell, y, x int) {
-	if grid[y][x] == empty {
-		grid[y][x] = occupied
-	} else {
-		grid[y][x] = empty
+// Renders the seat map of the current round
+func (s *simulation) seatMap() [][]cell {
+	grid := copyGrid(s.grid)
+	for i, seat := range s.seats {
+		grid[seat[0]][seat[1]] = s.rules.cells.empty
+		if s.occupied[i] == 1 {
+			grid[seat[0]][seat[1]] = s.rules.cells.occupied
+		}
 	}
+	return grid
 }
 
 func isValidCoord(grid [][]cell, y, x int) bool {
@@ -218,10 +370,7 @@ func printGrid(grid [][]cell) {
 	fmt.Println(strings.Repeat("=", len(grid[0])))
 	fmt.Println()
 	for y := 0; y < len(grid); y++ {
-		for x := 0; x < len(grid[y]); x++ {
-			fmt.Printf(string(grid[y][x]))
-		}
-		fmt.Println()
+		fmt.Println(string(grid[y]))
 	}
 	fmt.Println()
 	fmt.Println(strings.Repeat("=", len(grid[0])))
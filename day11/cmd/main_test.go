@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"fmt"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -37,3 +40,165 @@ func openTestInput(t *testing.T) *os.File {
 
 	return file
 }
+
+const example1 = `L.LL.LL.LL
+LLLLLLL.LL
+L.L.L..L..
+LLLL.LL.LL
+L.LL.LL.LL
+L.LLLLL.LL
+..L.L.....
+LLLLLLLLLL
+L.LLLLLL.L
+L.LLLLL.LL`
+
+func TestOccupancy(t *testing.T) {
+	t.Parallel()
+	conditions := []struct {
+		rules     ruleSet
+		rounds    int
+		occupancy []int
+	}{
+		{rules: part1Rules, rounds: 5, occupancy: []int{0, 71, 20, 51, 30, 37}},
+		{rules: part2Rules, rounds: 6, occupancy: []int{0, 71, 7, 53, 18, 31, 26}},
+	}
+
+	for i, cond := range conditions {
+		result := mustRun(loadGrid(strings.NewReader(example1)), cond.rules, 100, 1)
+		if result.rounds != cond.rounds || result.cycleLength != 1 {
+			t.Errorf("Example %d: expected to stabilize after %d rounds got %s\n", i+1, cond.rounds, result)
+		}
+		if fmt.Sprint(result.occupancy) != fmt.Sprint(cond.occupancy) {
+			t.Errorf("Example %d: expected occupancy %v got %v\n", i+1, cond.occupancy, result.occupancy)
+		}
+	}
+}
+
+func TestCustomRules(t *testing.T) {
+	t.Parallel()
+
+	// nobody tolerates a neighbour, so the seats flip back and forth forever
+	rules := ruleSet{mode: adjacent, tolerance: 1, cells: alphabet{floor: '_', empty: 'o', occupied: 'x'}}
+	result := mustRun(loadGrid(strings.NewReader("oo\n__")), rules, 100, 1)
+	if result.cycleLength != 2 || result.cycleStart != 0 {
+		t.Errorf("expected a cycle of 2 rounds from round 0 got %s\n", result)
+	}
+
+	// with a short line of sight, the far seat can't be seen
+	rules = ruleSet{mode: lineOfSight, tolerance: 1, maxSight: 2, cells: defaultAlphabet}
+	sim, err := newSimulation(loadGrid(strings.NewReader("#..#\n#...")), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sim.countNeighbours(0); got != 1 {
+		t.Errorf("expected 1 visible neighbour got %d\n", got)
+	}
+
+	if _, err := newSimulation(loadGrid(strings.NewReader("L.?")), part1Rules); err == nil {
+		t.Errorf("expected an error for an unknown cell")
+	}
+}
+
+// Generates a random seat map, with roughly the given percentage of it floor
+func generateGrid(height, width, floorPercent int, seed int64) [][]cell {
+	rng := rand.New(rand.NewSource(seed))
+	grid := make([][]cell, height)
+	for y := range grid {
+		grid[y] = make([]cell, width)
+		for x := range grid[y] {
+			grid[y][x] = defaultAlphabet.empty
+			if rng.Intn(100) < floorPercent {
+				grid[y][x] = defaultAlphabet.floor
+			}
+		}
+	}
+	return grid
+}
+
+// The original implementation, re-walking every ray on every round
+func referenceStep(grid [][]cell, rules ruleSet) ([][]cell, bool) {
+	next := copyGrid(grid)
+	changed := false
+	for y := range grid {
+		for x, v := range grid[y] {
+			if v == rules.cells.floor {
+				continue
+			}
+			count := 0
+			for _, vec := range vectors {
+				dy, dx := y, x
+				for dist := 1; rules.mode == lineOfSight || dist <= 1; dist++ {
+					dy, dx = dy+vec[0], dx+vec[1]
+					if !isValidCoord(grid, dy, dx) {
+						break
+					}
+					if grid[dy][dx] != rules.cells.floor {
+						if grid[dy][dx] == rules.cells.occupied {
+							count++
+						}
+						break
+					}
+				}
+			}
+			if v == rules.cells.empty && count == 0 {
+				next[y][x] = rules.cells.occupied
+				changed = true
+			}
+			if v == rules.cells.occupied && count >= rules.tolerance {
+				next[y][x] = rules.cells.empty
+				changed = true
+			}
+		}
+	}
+	return next, changed
+}
+
+func TestMatchesReference(t *testing.T) {
+	t.Parallel()
+	for _, rules := range []ruleSet{part1Rules, part2Rules} {
+		for _, workers := range []int{1, 3} {
+			grid := generateGrid(40, 57, 25, 11)
+			sim, err := newSimulation(grid, rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sim.workers = workers
+
+			for round := 1; ; round++ {
+				var changed bool
+				grid, changed = referenceStep(grid, rules)
+				sim.step()
+				if fmt.Sprint(sim.seatMap()) != fmt.Sprint(grid) {
+					t.Fatalf("mode %d workers %d: seat maps differ after round %d\n", rules.mode, workers, round)
+				}
+				if !changed {
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkReference(b *testing.B) {
+	grid := generateGrid(400, 400, 60, 7)
+	for i := 0; i < b.N; i++ {
+		g, changed := grid, true
+		for changed {
+			g, changed = referenceStep(g, part2Rules)
+		}
+	}
+}
+
+func BenchmarkSimulation(b *testing.B) {
+	grid := generateGrid(400, 400, 60, 7)
+	for i := 0; i < b.N; i++ {
+		mustRun(grid, part2Rules, 10000, 1)
+	}
+}
+
+func BenchmarkSimulationParallel(b *testing.B) {
+	grid := generateGrid(400, 400, 60, 7)
+	for i := 0; i < b.N; i++ {
+		mustRun(grid, part2Rules, 10000, 4)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Writes the trajectory as an SVG image, with north pointing up
+//
+// The ship's path is drawn as a line, with markers for where it started and ended. When waypoints is true,
+// the vector from the ship to its waypoint is drawn at every point along the path.
+func writeSVG(w io.Writer, track []trackPoint, waypoints bool) error {
+	if len(track) == 0 {
+		return fmt.Errorf("can't draw an empty trajectory")
+	}
+
+	// Find the bounds of everything that gets drawn
+	minE, maxE := track[0].position.e, track[0].position.e
+	minN, maxN := track[0].position.n, track[0].position.n
+	extend := func(c coord) {
+		minE, maxE = math.Min(minE, c.e), math.Max(maxE, c.e)
+		minN, maxN = math.Min(minN, c.n), math.Max(maxN, c.n)
+	}
+	for _, p := range track {
+		extend(p.position)
+		if waypoints {
+			extend(p.position.add(p.waypoint))
+		}
+	}
+
+	width, height := maxE-minE, maxN-minN
+	pad := math.Max(math.Max(width, height)/20, 1)
+	stroke := math.Max(width, height) / 500
+	if stroke == 0 {
+		stroke = 0.1
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%g %g %g %g">`+"\n",
+		minE-pad, svgY(maxN)-pad, width+2*pad, height+2*pad)
+
+	if waypoints {
+		fmt.Fprintf(&sb, `  <g stroke="orange" stroke-width="%g" opacity="0.6">`+"\n", stroke)
+		for _, p := range track {
+			wp := p.position.add(p.waypoint)
+			fmt.Fprintf(&sb, `    <line x1="%g" y1="%g" x2="%g" y2="%g"/>`+"\n", p.position.e, svgY(p.position.n), wp.e, svgY(wp.n))
+		}
+		sb.WriteString("  </g>\n")
+	}
+
+	points := make([]string, len(track))
+	for i, p := range track {
+		points[i] = fmt.Sprintf("%g,%g", p.position.e, svgY(p.position.n))
+	}
+	fmt.Fprintf(&sb, `  <polyline fill="none" stroke="navy" stroke-width="%g" points="%s"/>`+"\n", stroke, strings.Join(points, " "))
+
+	start, end := track[0].position, track[len(track)-1].position
+	fmt.Fprintf(&sb, `  <circle cx="%g" cy="%g" r="%g" fill="green"><title>start</title></circle>`+"\n", start.e, svgY(start.n), stroke*4)
+	fmt.Fprintf(&sb, `  <circle cx="%g" cy="%g" r="%g" fill="red"><title>end</title></circle>`+"\n", end.e, svgY(end.n), stroke*4)
+	sb.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// SVG's y axis points down, so north is negated (without producing "-0")
+func svgY(n float64) float64 {
+	return 0 - n
+}
+
+// A position on the earth, in degrees
+type latLon struct {
+	lat float64
+	lon float64
+}
+
+// Parses a position such as "51.5,-0.12"
+func parseLatLon(text string) (latLon, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 {
+		return latLon{}, fmt.Errorf("expected latitude,longitude got %q", text)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return latLon{}, fmt.Errorf("bad latitude %q", parts[0])
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return latLon{}, fmt.Errorf("bad longitude %q", parts[1])
+	}
+	return latLon{lat: lat, lon: lon}, nil
+}
+
+// the length of each unit of movement in meters
+var units = map[string]float64{
+	"m":   1,
+	"km":  1000,
+	"ft":  0.3048,
+	"nmi": 1852,
+}
+
+func parseUnit(name string) (float64, error) {
+	meters, ok := units[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", name)
+	}
+	return meters, nil
+}
+
+const metersPerDegree = 111320.0 // roughly, for a degree of latitude
+
+// Converts a ship position into a [longitude, latitude] pair, using a flat earth around the origin
+func (o latLon) project(c coord, unitMeters float64) [2]float64 {
+	lat := o.lat + c.n*unitMeters/metersPerDegree
+	lon := o.lon + c.e*unitMeters/(metersPerDegree*math.Cos(o.lat*math.Pi/180))
+	return [2]float64{lon, lat}
+}
+
+// Writes the trajectory as a GeoJSON Feature with a LineString geometry
+func writeGeoJSON(w io.Writer, track []trackPoint, origin latLon, unitMeters float64) error {
+	type geometry struct {
+		Type        string       `json:"type"`
+		Coordinates [][2]float64 `json:"coordinates"`
+	}
+	type feature struct {
+		Type       string                 `json:"type"`
+		Geometry   geometry               `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+
+	line := geometry{Type: "LineString"}
+	for _, p := range track {
+		line.Coordinates = append(line.Coordinates, origin.project(p.position, unitMeters))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(feature{
+		Type:     "Feature",
+		Geometry: line,
+		Properties: map[string]interface{}{
+			"name":       "ship",
+			"unitMeters": unitMeters,
+		},
+	})
+}
+
+func (c coord) add(o coord) coord {
+	return coord{n: c.n + o.n, e: c.e + o.e}
+}
@@ -1,23 +1,27 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"log"
+	"math"
+	"os"
 	"strconv"
+	"strings"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
-type direction int
-
+// headings, in degrees counter-clockwise from east
 const (
-	east direction = iota
-	north
-	west
-	south
+	east  = 0.0
+	north = 90.0
+	west  = 180.0
+	south = 270.0
 )
 
-var headingNames = map[direction]byte{
+var headingNames = map[float64]byte{
 	east:  'E',
 	north: 'N',
 	west:  'W',
@@ -34,46 +38,160 @@ const (
 	rotateLeft  action = 'L'
 	rotateRight action = 'R'
 	moveForward action = 'F'
+	flyBearing  action = 'B' // move at a compass bearing, e.g. "B45,10"
+	setHeading  action = 'H' // turn to face a compass bearing, e.g. "H270"
 )
 
 type coord struct {
-	n int
-	e int
+	n float64
+	e float64
 }
 
 func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
-}
+	part := flag.Int("part", 2, "which part's pilot to export the trajectory of")
+	svgPath := flag.String("svg", "", "write the trajectory to this file as SVG")
+	geoJSONPath := flag.String("geojson", "", "write the trajectory to this file as a GeoJSON LineString")
+	originText := flag.String("origin", "0,0", "the latitude,longitude the ship starts from in the GeoJSON output")
+	unitName := flag.String("units", "nmi", "the distance each unit of movement covers in the GeoJSON output (m, km, ft or nmi)")
+	flag.Parse()
+
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+
+	commands, err := loadCommands(file)
+	common.MustNotError(err)
+	vessel1, err := navigate(part1Pilot, commands)
+	common.MustNotError(err)
+	vessel2, err := navigate(part2Pilot, commands)
+	common.MustNotError(err)
+	fmt.Printf("Part 1: %d\n", vessel1.distance())
+	fmt.Printf("Part 2: %d\n", vessel2.distance())
+
+	vessel, waypoints := vessel2, true
+	if *part == 1 {
+		vessel, waypoints = vessel1, false
+	}
 
-func part1(reader io.Reader) int {
-	vessel := newShip(false)
-	common.ScanLines(reader, func(line string) {
-		action := action(line[0])
-		val, err := strconv.Atoi(string(line[1:]))
+	if *svgPath != "" {
+		out, err := os.Create(*svgPath)
 		common.MustNotError(err)
-		vessel.fly(part1Pilot, action, val)
-	})
+		common.MustNotError(writeSVG(out, vessel.track, waypoints))
+		common.MustNotError(out.Close())
+	}
 
-	return abs(vessel.position.e) + abs(vessel.position.n)
+	if *geoJSONPath != "" {
+		origin, err := parseLatLon(*originText)
+		common.MustNotError(err)
+		unit, err := parseUnit(*unitName)
+		common.MustNotError(err)
+
+		out, err := os.Create(*geoJSONPath)
+		common.MustNotError(err)
+		common.MustNotError(writeGeoJSON(out, vessel.track, origin, unit))
+		common.MustNotError(out.Close())
+	}
 }
 
-func part2(reader io.Reader) int {
-	vessel := newShip(false)
+// A single navigation instruction
+type command struct {
+	action  action
+	value   float64
+	bearing float64 // compass bearing (clockwise from north) for actions that need a direction
+}
+
+func (c command) String() string {
+	if c.action == flyBearing {
+		return fmt.Sprintf("%c%g,%g", c.action, c.bearing, c.value)
+	}
+	return fmt.Sprintf("%c%g", c.action, c.value)
+}
+
+// Parses a command, such as "F10", "L-45" or "B135,20"
+func parseCommand(line string) (command, error) {
+	if len(line) < 2 {
+		return command{}, fmt.Errorf("bad command %q", line)
+	}
+	c := command{action: action(line[0])}
+
+	args := strings.Split(line[1:], ",")
+	if c.action == flyBearing {
+		if len(args) != 2 {
+			return command{}, fmt.Errorf("bad command %q: expected a bearing and a distance", line)
+		}
+		bearing, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return command{}, fmt.Errorf("bad command %q: %w", line, err)
+		}
+		c.bearing = bearing
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return command{}, fmt.Errorf("bad command %q", line)
+	}
+
+	val, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return command{}, fmt.Errorf("bad command %q: %w", line, err)
+	}
+	c.value = val
+
+	return c, nil
+}
+
+func loadCommands(reader io.Reader) ([]command, error) {
+	var commands []command
+	var err error
 	common.ScanLines(reader, func(line string) {
-		a := action(line[0])
-		val, err := strconv.Atoi(string(line[1:]))
-		common.MustNotError(err)
-		vessel.fly(part2Pilot, a, val)
+		if err != nil || line == "" {
+			return
+		}
+		var c command
+		if c, err = parseCommand(line); err == nil {
+			commands = append(commands, c)
+		}
 	})
+	return commands, err
+}
 
-	return abs(vessel.position.e) + abs(vessel.position.n)
+// Flies a new ship through every command
+func navigate(p pilot, commands []command) (ship, error) {
+	vessel := newShip(false)
+	for i, c := range commands {
+		if err := vessel.fly(p, c); err != nil {
+			return vessel, fmt.Errorf("command %d: %w", i+1, err)
+		}
+	}
+	return vessel, nil
+}
+
+func mustNavigate(p pilot, reader io.Reader) ship {
+	commands, err := loadCommands(reader)
+	common.MustNotError(err)
+	vessel, err := navigate(p, commands)
+	common.MustNotError(err)
+	return vessel
+}
+
+func part1(reader io.Reader) int {
+	vessel := mustNavigate(part1Pilot, reader)
+	return vessel.distance()
 }
 
-type pilot func(s *ship, a action, val int)
+func part2(reader io.Reader) int {
+	vessel := mustNavigate(part2Pilot, reader)
+	return vessel.distance()
+}
 
-func part1Pilot(s *ship, a action, val int) {
-	switch a {
+type pilot func(s *ship, c command) error
+
+func part1Pilot(s *ship, c command) error {
+	val := c.value
+	switch c.action {
 	case flyNorth:
 		s.move(val, 0)
 	case flySouth:
@@ -88,11 +206,20 @@ func part1Pilot(s *ship, a action, val int) {
 		s.rotateHeading(false, val)
 	case moveForward:
 		s.moveForward(val)
+	case flyBearing:
+		n, e := unitVector(compassToHeading(c.bearing))
+		s.move(n*val, e*val)
+	case setHeading:
+		s.heading = normalizeDegrees(compassToHeading(val))
+	default:
+		return fmt.Errorf("unknown action %q", c.action)
 	}
+	return nil
 }
 
-func part2Pilot(s *ship, a action, val int) {
-	switch a {
+func part2Pilot(s *ship, c command) error {
+	val := c.value
+	switch c.action {
 	case flyNorth:
 		s.moveWaypoint(val, 0)
 	case flySouth:
@@ -110,25 +237,68 @@ func part2Pilot(s *ship, a action, val int) {
 	case moveForward:
 		// move ship waypoint amount
 		s.moveToWaypoint(val)
+	case flyBearing:
+		n, e := unitVector(compassToHeading(c.bearing))
+		s.moveWaypoint(n*val, e*val)
+	case setHeading:
+		// point the waypoint along the bearing, keeping its distance
+		length := math.Hypot(s.waypoint.n, s.waypoint.e)
+		n, e := unitVector(compassToHeading(val))
+		s.waypoint = coord{n: n * length, e: e * length}
+	default:
+		return fmt.Errorf("unknown action %q", c.action)
 	}
+	return nil
 }
 
-func abs(x int) int {
-	if x < 0 {
-		return -x
+// Converts a compass bearing (clockwise from north) to a heading (counter-clockwise from east)
+func compassToHeading(bearing float64) float64 {
+	return 90 - bearing
+}
+
+// Brings an angle into [0, 360)
+func normalizeDegrees(degrees float64) float64 {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
 	}
-	return x
+	return degrees
+}
+
+// Finds the north and east parts of a unit vector pointing along the heading
+//
+// Headings on the cardinal directions are exact, so ships that only make right angle turns stay on whole numbers
+func unitVector(heading float64) (float64, float64) {
+	switch normalizeDegrees(heading) {
+	case east:
+		return 0, 1
+	case north:
+		return 1, 0
+	case west:
+		return 0, -1
+	case south:
+		return -1, 0
+	}
+	rad := heading * math.Pi / 180
+	return math.Sin(rad), math.Cos(rad)
 }
 
 type ship struct {
 	debug    bool
-	heading  direction
+	heading  float64 // degrees counter-clockwise from east
 	position coord
 	waypoint coord
+	track    []trackPoint // every position the ship has been in, starting with where it set off from
+}
+
+// A point along the ship's trajectory
+type trackPoint struct {
+	position coord
+	waypoint coord // relative to the ship
 }
 
 func newShip(debug bool) ship {
-	return ship{
+	s := ship{
 		debug:   debug,
 		heading: east,
 		position: coord{
@@ -140,83 +310,82 @@ func newShip(debug bool) ship {
 			e: 10,
 		},
 	}
+	s.record()
+	return s
 }
 
-func (s *ship) move(n, e int) {
-	s.position.n += n
-	s.position.e += e
+// Adds the current position to the trajectory
+func (s *ship) record() {
+	s.track = append(s.track, trackPoint{position: s.position, waypoint: s.waypoint})
 }
 
-func (s *ship) moveForward(amount int) {
-	switch s.heading {
-	case north:
-		s.position.n += amount
-	case south:
-		s.position.n -= amount
-	case east:
-		s.position.e += amount
-	case west:
-		s.position.e -= amount
-	}
+// The manhattan distance from where the ship set off, rounded to the nearest unit
+func (s *ship) distance() int {
+	return int(math.Round(math.Abs(s.position.e) + math.Abs(s.position.n)))
 }
 
-func (s *ship) rotateHeading(left bool, degrees int) {
-	numRotations := (degrees % 360) / 90
-	for i := 0; i < numRotations; i++ {
-		s.heading = rotate90(s.heading, left)
-	}
+func (s *ship) move(n, e float64) {
+	s.position.n += n
+	s.position.e += e
 }
 
-func rotate90(heading direction, left bool) direction {
-	if left {
-		return (heading + 1) % 4
-	}
+func (s *ship) moveForward(amount float64) {
+	n, e := unitVector(s.heading)
+	s.move(n*amount, e*amount)
+}
 
-	next := heading - 1
-	if next < 0 {
-		next = south
+// Turns the ship by any angle, negative angles turn the other way
+func (s *ship) rotateHeading(left bool, degrees float64) {
+	if !left {
+		degrees = -degrees
 	}
-
-	return next
+	s.heading = normalizeDegrees(s.heading + degrees)
 }
 
 func (s *ship) print() {
-	fmt.Printf("heading=%c north=%d east=%d waypoint[n=%d,e=%d]\n", headingNames[s.heading], s.position.n, s.position.e, s.waypoint.n, s.waypoint.e)
+	heading := fmt.Sprintf("%g", s.heading)
+	if name, ok := headingNames[s.heading]; ok {
+		heading = string(name)
+	}
+	fmt.Printf("heading=%s north=%g east=%g waypoint[n=%g,e=%g]\n", heading, s.position.n, s.position.e, s.waypoint.n, s.waypoint.e)
 }
 
-func (s *ship) rotateWaypoint(left bool, degrees int) {
-	numRotations := (degrees % 360) / 90
-	for i := 0; i < numRotations; i++ {
-		if left {
-			s.waypoint.e, s.waypoint.n = -s.waypoint.n, s.waypoint.e
-		} else {
-			s.waypoint.e, s.waypoint.n = s.waypoint.n, -s.waypoint.e
-		}
+// Rotates the waypoint around the ship by any angle, negative angles rotate the other way
+func (s *ship) rotateWaypoint(left bool, degrees float64) {
+	if !left {
+		degrees = -degrees
 	}
+	n, e := unitVector(degrees)
+	// n and e are the sine and cosine of the angle
+	s.waypoint.e, s.waypoint.n = s.waypoint.e*e-s.waypoint.n*n, s.waypoint.e*n+s.waypoint.n*e
 }
 
-func (s *ship) fly(p pilot, a action, val int) {
+func (s *ship) fly(p pilot, c command) error {
 
 	if s.debug {
 		// Print instruction issued
-		fmt.Printf("%s%d\n", string(a), val)
+		fmt.Println(c)
 	}
 
 	// Pilot follows instructions
-	p(s, a, val)
+	if err := p(s, c); err != nil {
+		return err
+	}
+	s.record()
 
 	if s.debug {
 		// Print next ship state
 		s.print()
 	}
+	return nil
 }
 
-func (s *ship) moveWaypoint(n, e int) {
+func (s *ship) moveWaypoint(n, e float64) {
 	s.waypoint.n += n
 	s.waypoint.e += e
 }
 
-func (s *ship) moveToWaypoint(units int) {
+func (s *ship) moveToWaypoint(units float64) {
 	s.position.e += s.waypoint.e * units
 	s.position.n += s.waypoint.n * units
 }
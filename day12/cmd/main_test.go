@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"math"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -29,30 +32,147 @@ func TestPart2(t *testing.T) {
 	}
 }
 
-func TestRotate90(t *testing.T) {
+func TestRotateHeading(t *testing.T) {
 	for _, testRot := range []struct {
-		initial  direction
+		initial  float64
 		left     bool
-		expected direction
+		degrees  float64
+		expected float64
 	}{
 		// Left
-		{north, true, west},
-		{west, true, south},
-		{south, true, east},
-		{east, true, north},
+		{north, true, 90, west},
+		{west, true, 90, south},
+		{south, true, 90, east},
+		{east, true, 90, north},
 		// Right
-		{north, false, east},
-		{west, false, north},
-		{south, false, west},
-		{east, false, south},
+		{north, false, 90, east},
+		{west, false, 90, north},
+		{south, false, 90, west},
+		{east, false, 90, south},
+		// Any angle
+		{east, true, 45, 45},
+		{east, false, 30, 330},
+		{north, true, -135, 315},
+		{west, false, 720, west},
 	} {
-		got := rotate90(testRot.initial, testRot.left)
-		if got != testRot.expected {
-			t.Errorf("initial %c, rotate left=%t wanted %c, got %c\n", headingNames[testRot.initial], testRot.left, headingNames[testRot.expected], headingNames[got])
+		s := newShip(false)
+		s.heading = testRot.initial
+		s.rotateHeading(testRot.left, testRot.degrees)
+		if s.heading != testRot.expected {
+			t.Errorf("initial %g, rotate left=%t by %g wanted %g, got %g\n", testRot.initial, testRot.left, testRot.degrees, testRot.expected, s.heading)
 		}
 	}
 }
 
+func TestArbitraryAngles(t *testing.T) {
+	t.Parallel()
+	conditions := []struct {
+		commands string
+		pilot    pilot
+		want     coord
+	}{
+		{commands: "L45\nF10\nR-45\nF2", pilot: part1Pilot, want: coord{n: 9.0711, e: 7.0711}},
+		{commands: "B180,3\nH90\nF1\nW4", pilot: part1Pilot, want: coord{n: -3, e: -3}},
+		{commands: "R45\nF1", pilot: part2Pilot, want: coord{n: -6.364, e: 7.7782}},
+		{commands: "H0\nF2\nB90,1", pilot: part2Pilot, want: coord{n: 20.0998, e: 0}},
+	}
+
+	for i, cond := range conditions {
+		commands, err := loadCommands(strings.NewReader(cond.commands))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vessel, err := navigate(cond.pilot, commands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(vessel.position.n-cond.want.n) > 1e-3 || math.Abs(vessel.position.e-cond.want.e) > 1e-3 {
+			t.Errorf("Example %d: expected %v got %v\n", i+1, cond.want, vessel.position)
+		}
+	}
+}
+
+func TestUnknownAction(t *testing.T) {
+	t.Parallel()
+	commands, err := loadCommands(strings.NewReader("F10\nX3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := navigate(part1Pilot, commands); err == nil {
+		t.Errorf("expected an error for an unknown action")
+	}
+	if _, err := loadCommands(strings.NewReader("B10")); err == nil {
+		t.Errorf("expected an error for a bearing without a distance")
+	}
+	if commands, err := loadCommands(strings.NewReader("F10\nB10\nF5")); err == nil || len(commands) != 1 {
+		t.Errorf("expected an error after the 1 good command, got %d commands and %v", len(commands), err)
+	}
+}
+
+const example1 = `F10
+N3
+F7
+R90
+F11`
+
+func TestTrajectory(t *testing.T) {
+	t.Parallel()
+	vessel := mustNavigate(part2Pilot, strings.NewReader(example1))
+
+	want := []coord{{0, 0}, {10, 100}, {10, 100}, {38, 170}, {38, 170}, {-72, 214}}
+	if len(vessel.track) != len(want) {
+		t.Fatalf("expected %d points got %d\n", len(want), len(vessel.track))
+	}
+	for i, p := range vessel.track {
+		if p.position != want[i] {
+			t.Errorf("point %d: expected %v got %v\n", i, want[i], p.position)
+		}
+	}
+	if got := vessel.track[4].waypoint; got != (coord{n: -10, e: 4}) {
+		t.Errorf("expected the waypoint to end up at n=-10,e=4 got %v\n", got)
+	}
+
+	var svg strings.Builder
+	if err := writeSVG(&svg, vessel.track, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(svg.String(), `points="0,0 100,-10 100,-10 170,-38 170,-38 214,72"`) {
+		t.Errorf("expected the ship path in the SVG, got:\n%s", svg.String())
+	}
+	if strings.Count(svg.String(), "<line ") != len(want) {
+		t.Errorf("expected a waypoint vector per point, got:\n%s", svg.String())
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	t.Parallel()
+	vessel := mustNavigate(part1Pilot, strings.NewReader(example1))
+
+	var out strings.Builder
+	if err := writeGeoJSON(&out, vessel.track, latLon{lat: 0, lon: 10}, metersPerDegree); err != nil {
+		t.Fatal(err)
+	}
+
+	var feature struct {
+		Geometry struct {
+			Type        string
+			Coordinates [][2]float64
+		}
+	}
+	if err := json.Unmarshal([]byte(out.String()), &feature); err != nil {
+		t.Fatal(err)
+	}
+	if feature.Geometry.Type != "LineString" {
+		t.Errorf("expected a LineString got %s\n", feature.Geometry.Type)
+	}
+
+	// each unit is a degree at the equator
+	last := feature.Geometry.Coordinates[len(feature.Geometry.Coordinates)-1]
+	if len(feature.Geometry.Coordinates) != 6 || last != [2]float64{27, -8} {
+		t.Errorf("expected 6 points ending at [27 -8] got %v\n", feature.Geometry.Coordinates)
+	}
+}
+
 func openTestInput(t *testing.T) *os.File {
 	file, err := os.Open("../test-input.txt")
 	if err != nil {
@@ -1,91 +1,237 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
-	"math"
+	"log"
 	"math/big"
+	"os"
 	"strconv"
 	"strings"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
+const usage = `usage:
+  day13 <input>                solve both parts
+  day13 next [flags] <input>   list upcoming departures (-bus id, -after time, -n count)
+  day13 align [flags] <input>  find when buses depart at their offsets in a schedule (-schedule list)`
+
 func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch os.Args[1] {
+	case "next":
+		runNext(os.Args[2:])
+	case "align":
+		runAlign(os.Args[2:])
+	default:
+		fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
+		fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
+	}
 }
 
-func part1(reader io.Reader) int {
-	lines := common.ReadStringLines(reader)
-	departAt, err := strconv.Atoi(lines[0])
+// Opens the input file named by the only argument left after the flags
+func openSubcommandInput(flags *flag.FlagSet, args []string) *os.File {
+	common.MustNotError(flags.Parse(args))
+	if flags.NArg() != 1 {
+		log.Fatal(usage)
+	}
+	file, err := os.Open(flags.Arg(0))
 	common.MustNotError(err)
+	return file
+}
 
-	busses := strings.Split(lines[1], ",")
-	var busNums []int
-	for _, b := range busses {
-		if b == "x" {
-			continue
-		}
-		bn, err := strconv.Atoi(b)
+func runNext(args []string) {
+	flags := flag.NewFlagSet("next", flag.ExitOnError)
+	busID := flags.Int("bus", 0, "the bus to list departures of, 0 for every bus")
+	after := flags.Int("after", -1, "list departures at or after this time (default the earliest time in the input)")
+	count := flags.Int("n", 5, "how many departures to list")
+	file := openSubcommandInput(flags, args)
+	defer file.Close()
+	if *count < 0 {
+		log.Fatalf("-n can't be negative\n%s", usage)
+	}
+	if *busID < 0 {
+		log.Fatalf("-bus can't be negative\n%s", usage)
+	}
+
+	tt, err := loadTimetable(file)
+	common.MustNotError(err)
+	if *after < 0 {
+		*after = tt.earliest
+	}
+
+	buses := tt.buses
+	if *busID != 0 {
+		buses = []bus{{id: *busID}}
+	}
+	for _, b := range buses {
+		departures := b.nextDepartures(*after, *count)
+		fmt.Printf("Bus %d: %s\n", b.id, strings.Trim(fmt.Sprint(departures), "[]"))
+	}
+}
+
+func runAlign(args []string) {
+	flags := flag.NewFlagSet("align", flag.ExitOnError)
+	schedule := flags.String("schedule", "", "buses in the input's format, e.g. \"7,13,x,x,59\" (default the input's schedule)")
+	file := openSubcommandInput(flags, args)
+	defer file.Close()
+
+	tt, err := loadTimetable(file)
+	common.MustNotError(err)
+
+	buses := tt.buses
+	if *schedule != "" {
+		buses, err = parseSchedule(*schedule)
 		common.MustNotError(err)
-		busNums = append(busNums, bn)
 	}
 
-	closestBus := -1
-	closestTime := math.MaxInt64
-	for _, bn := range busNums {
-		time := departAt / bn
-		time *= bn
-		if time < departAt {
-			time += bn
-		}
-		if time < closestTime {
-			closestTime = time
-			closestBus = bn
-		}
+	t, period, err := align(buses)
+	common.MustNotError(err)
+	fmt.Printf("Earliest time: %s\n", t)
+	fmt.Printf("Repeats every: %s\n", period)
+}
+
+// A bus and its position in the schedule
+type bus struct {
+	id     int // also how often the bus departs
+	offset int // how long after the aligned time the bus should depart
+}
+
+// The next departure of the bus at or after the time
+func (b bus) nextDeparture(after int) int {
+	time := after / b.id
+	time *= b.id
+	if time < after {
+		time += b.id
 	}
+	return time
+}
 
-	return closestBus * (closestTime - departAt)
+// Lists the next n departures of the bus at or after the time
+func (b bus) nextDepartures(after, n int) []int {
+	departures := make([]int, n)
+	time := b.nextDeparture(after)
+	for i := range departures {
+		departures[i] = time
+		time += b.id
+	}
+	return departures
 }
 
-func part2(reader io.Reader) int64 {
+// The earliest time we can leave, and the bus schedule
+type timetable struct {
+	earliest int
+	buses    []bus
+}
+
+func loadTimetable(reader io.Reader) (timetable, error) {
 	lines := common.ReadStringLines(reader)
+	if len(lines) < 2 {
+		return timetable{}, fmt.Errorf("expected a time and a list of buses")
+	}
 
-	busses := strings.Split(lines[1], ",")
-	var a []*big.Int
-	var n []*big.Int
-	for i, b := range busses {
+	departAt, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return timetable{}, fmt.Errorf("bad time %q: %w", lines[0], err)
+	}
+
+	buses, err := parseSchedule(lines[1])
+	if err != nil {
+		return timetable{}, err
+	}
+
+	return timetable{earliest: departAt, buses: buses}, nil
+}
+
+// Parses a comma separated list of buses, where "x" means there is no constraint at that offset
+func parseSchedule(line string) ([]bus, error) {
+	var buses []bus
+	for i, b := range strings.Split(strings.TrimSpace(line), ",") {
 		if b == "x" {
 			continue
 		}
-		busNum, err := strconv.Atoi(b)
-		common.MustNotError(err)
-		a = append(a, big.NewInt(int64(busNum-i)))
-		n = append(n, big.NewInt(int64(busNum)))
+		id, err := strconv.Atoi(b)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("bad bus %q", b)
+		}
+		buses = append(buses, bus{id: id, offset: i})
+	}
+	if len(buses) == 0 {
+		return nil, fmt.Errorf("no buses in the schedule %q", line)
 	}
+	return buses, nil
+}
 
-	result, err := crt(a, n)
+// Finds the bus that departs soonest after the time, and when it departs
+func (tt timetable) soonest(after int) (bus, int) {
+	best, bestTime := tt.buses[0], tt.buses[0].nextDeparture(after)
+	for _, b := range tt.buses[1:] {
+		if time := b.nextDeparture(after); time < bestTime {
+			best, bestTime = b, time
+		}
+	}
+	return best, bestTime
+}
+
+// Finds the earliest time t where each bus departs at t + its offset, and the period after which that repeats
+func align(buses []bus) (*big.Int, *big.Int, error) {
+	var a []*big.Int
+	var n []*big.Int
+	for _, b := range buses {
+		a = append(a, big.NewInt(int64(-b.offset)))
+		n = append(n, big.NewInt(int64(b.id)))
+	}
+	return crt(a, n)
+}
+
+func part1(reader io.Reader) int {
+	tt, err := loadTimetable(reader)
+	common.MustNotError(err)
+
+	b, time := tt.soonest(tt.earliest)
+	return b.id * (time - tt.earliest)
+}
+
+func part2(reader io.Reader) int64 {
+	tt, err := loadTimetable(reader)
+	common.MustNotError(err)
+
+	result, _, err := align(tt.buses)
 	common.MustNotError(err)
 	return result.Int64()
 }
 
-var one = big.NewInt(1)
+// Solves the system x = a[i] (mod n[i]), returning the smallest non-negative x and the period (lcm of n)
+//
+// The moduli don't need to be coprime. It is an error if the congruences contradict each other
+func crt(a, n []*big.Int) (*big.Int, *big.Int, error) {
+	x := new(big.Int).Mod(a[0], n[0])
+	period := new(big.Int).Set(n[0])
 
-// https://rosettacode.org/wiki/Chinese_remainder_theorem#Go
-func crt(a, n []*big.Int) (*big.Int, error) {
-	p := new(big.Int).Set(n[0])
-	for _, n1 := range n[1:] {
-		p.Mul(p, n1)
-	}
-	var x, q, s, z big.Int
-	for i, n1 := range n {
-		q.Div(p, n1)
-		z.GCD(nil, &s, n1, &q)
-		if z.Cmp(one) != 0 {
-			return nil, fmt.Errorf("%d not coprime", n1)
+	for i := 1; i < len(n); i++ {
+		// find k where x + k*period = a[i] (mod n[i])
+		var g, inv big.Int
+		g.GCD(&inv, nil, period, n[i])
+
+		diff := new(big.Int).Sub(a[i], x)
+		if new(big.Int).Mod(diff, &g).Sign() != 0 {
+			return nil, nil, fmt.Errorf("no time satisfies x = %s (mod %s) and x = %s (mod %s)", x, period, a[i], n[i])
 		}
-		x.Add(&x, s.Mul(a[i], s.Mul(&s, &q)))
+
+		m := new(big.Int).Div(n[i], &g)
+		k := diff.Div(diff, &g)
+		k.Mul(k, &inv)
+		k.Mod(k, m)
+
+		x.Add(x, k.Mul(k, period))
+		period.Mul(period, m)
+		x.Mod(x, period)
 	}
-	return x.Mod(&x, p), nil
+
+	return x, period, nil
 }
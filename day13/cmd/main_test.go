@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -37,3 +39,63 @@ func openTestInput(t *testing.T) *os.File {
 
 	return file
 }
+
+const example1 = `939
+7,13,x,x,59,x,31,19`
+
+func TestNextDepartures(t *testing.T) {
+	t.Parallel()
+	tt, err := loadTimetable(strings.NewReader(example1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, time := tt.soonest(tt.earliest)
+	if b.id != 59 || time != 944 {
+		t.Errorf("expected bus 59 at 944 got bus %d at %d\n", b.id, time)
+	}
+
+	want := "[944 1003 1062]"
+	if got := fmt.Sprint(b.nextDepartures(939, 3)); want != got {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+	if got := fmt.Sprint(bus{id: 7}.nextDepartures(945, 2)); got != "[945 952]" {
+		t.Errorf("expected departures to include the time itself, got %s\n", got)
+	}
+}
+
+func TestAlign(t *testing.T) {
+	t.Parallel()
+	conditions := []struct {
+		schedule string
+		time     string
+		period   string
+	}{
+		{schedule: "7,13,x,x,59,x,31,19", time: "1068781", period: "3162341"},
+		{schedule: "17,x,13,19", time: "3417", period: "4199"},
+		{schedule: "67,7,59,61", time: "754018", period: "1687931"},
+		{schedule: "1789,37,47,1889", time: "1202161486", period: "5876813119"},
+		// moduli that aren't coprime
+		{schedule: "4,x,6", time: "4", period: "12"},
+		{schedule: "x,x,59", time: "57", period: "59"},
+	}
+
+	for i, cond := range conditions {
+		buses, err := parseSchedule(cond.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time, period, err := align(buses)
+		if err != nil {
+			t.Fatalf("Example %d: %v\n", i+1, err)
+		}
+		if time.String() != cond.time || period.String() != cond.period {
+			t.Errorf("Example %d: expected %s every %s got %s every %s\n", i+1, cond.time, cond.period, time, period)
+		}
+	}
+
+	buses, _ := parseSchedule("4,6")
+	if _, _, err := align(buses); err == nil {
+		t.Errorf("expected an error for an impossible schedule")
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	common "github.com/torbensky/adventofcode-common"
+)
+
+// The word width of the ferry's docking computer
+const defaultWidth = 36
+
+type opKind int
+
+const (
+	setMask opKind = iota
+	writeMem
+)
+
+// A single line of the initialization program
+type instruction struct {
+	kind  opKind
+	mask  string   // for setMask
+	addr  uint64   // for writeMem
+	value *big.Int // for writeMem
+}
+
+func (inst instruction) String() string {
+	if inst.kind == setMask {
+		return "mask = " + inst.mask
+	}
+	return fmt.Sprintf("mem[%d] = %s", inst.addr, inst.value)
+}
+
+var (
+	maskRegex  = regexp.MustCompile(`^mask\s*=\s*([X01]+)$`)
+	writeRegex = regexp.MustCompile(`^mem\[(\d+)\]\s*=\s*(\d+)$`)
+)
+
+// Reads an initialization program, one instruction per line
+func loadProgram(reader io.Reader) ([]instruction, error) {
+	var program []instruction
+	var err error
+	common.ScanLines(reader, func(line string) {
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if m := maskRegex.FindStringSubmatch(line); m != nil {
+			program = append(program, instruction{kind: setMask, mask: m[1]})
+			return
+		}
+		m := writeRegex.FindStringSubmatch(line)
+		if m == nil {
+			err = fmt.Errorf("line %d: unexpected instruction %q", len(program)+1, line)
+			return
+		}
+		var addr big.Int
+		value, ok := new(big.Int).SetString(m[2], 10)
+		if _, okAddr := addr.SetString(m[1], 10); !ok || !okAddr || !addr.IsUint64() {
+			err = fmt.Errorf("line %d: bad numbers in %q", len(program)+1, line)
+			return
+		}
+		program = append(program, instruction{kind: writeMem, addr: addr.Uint64(), value: value})
+	})
+	return program, err
+}
+
+// A memory value, held in small for words of up to 64 bits and in wide for anything bigger
+type word struct {
+	small uint64
+	wide  *big.Int
+}
+
+// The value as a big integer, whatever the word size
+func (w word) Int() *big.Int {
+	if w.wide != nil {
+		return w.wide
+	}
+	return new(big.Int).SetUint64(w.small)
+}
+
+func (w word) equal(o word) bool {
+	if w.wide == nil && o.wide == nil {
+		return w.small == o.small
+	}
+	return w.Int().Cmp(o.Int()) == 0
+}
+
+// A version 1 bitmask: 1s and 0s overwrite bits of the value, Xs leave them alone
+type bitmask struct {
+	text               string
+	ones, keep         uint64
+	wideOnes, wideKeep *big.Int
+}
+
+// Parses a mask, which needs exactly one character for every bit of the word
+func parseMask(text string, width int) (bitmask, error) {
+	if len(text) != width {
+		return bitmask{}, fmt.Errorf("mask %q has %d bits but words are %d bits wide", text, len(text), width)
+	}
+
+	m := bitmask{text: text, wideOnes: new(big.Int), wideKeep: new(big.Int)}
+	for i, c := range text {
+		bit := uint(width - 1 - i)
+		switch c {
+		case 'X':
+			m.wideKeep.SetBit(m.wideKeep, int(bit), 1)
+		case '1':
+			m.wideOnes.SetBit(m.wideOnes, int(bit), 1)
+		case '0':
+		default:
+			return bitmask{}, fmt.Errorf("mask %q has an unknown bit %q", text, c)
+		}
+	}
+	if width <= 64 {
+		m.ones, m.keep = m.wideOnes.Uint64(), m.wideKeep.Uint64()
+	}
+	return m, nil
+}
+
+func (m bitmask) apply(w word) word {
+	if w.wide == nil {
+		return word{small: w.small&m.keep | m.ones}
+	}
+	v := new(big.Int).And(w.wide, m.wideKeep)
+	return word{wide: v.Or(v, m.wideOnes)}
+}
+
+// Runs initialization programs with the version 1 decoder chip, where masks apply to values
+type computer struct {
+	width    int
+	wide     bool // hold values as big integers instead of uint64
+	limit    *big.Int
+	mask     bitmask
+	mem      map[uint64]word
+	executed int
+}
+
+// Creates a computer with the given word width
+//
+// Words wider than 64 bits are always held as big integers, narrower ones only when wide is set
+func newComputer(width int, wide bool) (*computer, error) {
+	if width < 1 {
+		return nil, fmt.Errorf("the word width needs to be at least 1 bit, got %d", width)
+	}
+	c := &computer{
+		width: width,
+		wide:  wide || width > 64,
+		limit: new(big.Int).Lsh(big.NewInt(1), uint(width)),
+	}
+	c.reset()
+	return c, nil
+}
+
+// Clears memory and starts over with a mask that changes nothing
+func (c *computer) reset() {
+	c.mask, _ = parseMask(strings.Repeat("X", c.width), c.width)
+	c.mem = make(map[uint64]word)
+	c.executed = 0
+}
+
+// Executes a single instruction
+func (c *computer) exec(inst instruction) error {
+	switch inst.kind {
+	case setMask:
+		m, err := parseMask(inst.mask, c.width)
+		if err != nil {
+			return err
+		}
+		c.mask = m
+	case writeMem:
+		if new(big.Int).SetUint64(inst.addr).Cmp(c.limit) >= 0 {
+			return fmt.Errorf("address %d doesn't fit in %d bits", inst.addr, c.width)
+		}
+		if inst.value.Sign() < 0 || inst.value.Cmp(c.limit) >= 0 {
+			return fmt.Errorf("value %s doesn't fit in %d bits", inst.value, c.width)
+		}
+		w := word{small: inst.value.Uint64()}
+		if c.wide {
+			w = word{wide: new(big.Int).Set(inst.value)}
+		}
+		c.mem[inst.addr] = c.mask.apply(w)
+	}
+	c.executed++
+	return nil
+}
+
+// Executes every instruction of the program
+func (c *computer) run(program []instruction) error {
+	for i, inst := range program {
+		if err := c.exec(inst); err != nil {
+			return fmt.Errorf("instruction %d (%s): %w", i+1, inst, err)
+		}
+	}
+	return nil
+}
+
+// Copies the memory as it is right now
+func (c *computer) snapshot() snapshot {
+	s := snapshot{step: c.executed, width: c.width, mem: make(map[uint64]word, len(c.mem))}
+	for addr, w := range c.mem {
+		s.mem[addr] = w // words are never modified in place
+	}
+	return s
+}
+
+// Runs a program, taking a snapshot after each of the given numbers of instructions (0 is before the first one)
+func snapshotsOf(program []instruction, width int, wide bool, steps ...int) ([]snapshot, error) {
+	c, err := newComputer(width, wide)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[int]snapshot)
+	want := make(map[int]bool)
+	for _, step := range steps {
+		if step < 0 || step > len(program) {
+			return nil, fmt.Errorf("step %d is outside of the program's %d instructions", step, len(program))
+		}
+		want[step] = true
+	}
+	if want[0] {
+		taken[0] = c.snapshot()
+	}
+	for i, inst := range program {
+		if err := c.exec(inst); err != nil {
+			return nil, fmt.Errorf("instruction %d (%s): %w", i+1, inst, err)
+		}
+		if want[i+1] {
+			taken[i+1] = c.snapshot()
+		}
+	}
+
+	result := make([]snapshot, len(steps))
+	for i, step := range steps {
+		result[i] = taken[step]
+	}
+	return result, nil
+}
+
+// The memory of a computer after some number of instructions
+type snapshot struct {
+	step  int
+	width int
+	mem   map[uint64]word
+}
+
+// The addresses that have been written to, in order
+func (s snapshot) addresses() []uint64 {
+	addrs := make([]uint64, 0, len(s.mem))
+	for addr := range s.mem {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// Adds up every value in memory, without overflowing
+func (s snapshot) sum() *big.Int {
+	total := new(big.Int)
+	for _, w := range s.mem {
+		total.Add(total, w.Int())
+	}
+	return total
+}
+
+// Prints the table of addresses and values in hex and binary
+func (s snapshot) dump(w io.Writer) {
+	hexDigits := (s.width + 3) / 4
+	fmt.Fprintf(w, "after %d instructions, %d addresses, sum %s\n", s.step, len(s.mem), s.sum())
+	for _, addr := range s.addresses() {
+		v := s.mem[addr].Int()
+		fmt.Fprintf(w, "%0*x: 0x%0*x 0b%0*b (%s)\n", hexDigits, addr, hexDigits, v, s.width, v, v)
+	}
+}
+
+// A memory address with different values in two snapshots
+type change struct {
+	addr          uint64
+	before, after *big.Int // nil when the address hadn't been written to
+}
+
+func (ch change) String() string {
+	show := func(v *big.Int) string {
+		if v == nil {
+			return "unset"
+		}
+		return v.String()
+	}
+	return fmt.Sprintf("mem[%d]: %s -> %s", ch.addr, show(ch.before), show(ch.after))
+}
+
+// Finds every address whose value differs between two snapshots, in address order
+func diffSnapshots(a, b snapshot) []change {
+	var changes []change
+	seen := make(map[uint64]bool)
+	for _, s := range []snapshot{a, b} {
+		for _, addr := range s.addresses() {
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+
+			before, inA := a.mem[addr]
+			after, inB := b.mem[addr]
+			if inA && inB && before.equal(after) {
+				continue
+			}
+			ch := change{addr: addr}
+			if inA {
+				ch.before = before.Int()
+			}
+			if inB {
+				ch.after = after.Int()
+			}
+			changes = append(changes, ch)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].addr < changes[j].addr })
+	return changes
+}
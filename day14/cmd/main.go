@@ -1,140 +1,219 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"regexp"
-	"strconv"
-	"strings"
+	"math/big"
+	"math/bits"
+	"os"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
-func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
-}
+const usage = `usage:
+  day14 <input>                solve both parts
+  day14 dump [flags] <input>   print memory after some instructions (-after n, -width bits, -big)
+  day14 diff [flags] <input>   compare memory between two points of the program (-from n, -to n, -width bits, -big)`
 
-func part1(reader io.Reader) int {
-	var mask string
-	mem := make(map[int]int)
-	common.ScanLines(reader, func(line string) {
-		if strings.Contains(line, "mask") {
-			mask = strings.Fields(line)[2]
-		} else {
-			ma := processMem(line)
-			newVal := applyMask(ma.value, mask)
-			mem[ma.location] = newVal
-		}
-	})
-
-	sum := 0
-	for _, val := range mem {
-		sum += val
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
 	}
 
-	return sum
+	switch os.Args[1] {
+	case "dump":
+		runDump(os.Args[2:])
+	case "diff":
+		runDiff(os.Args[2:])
+	default:
+		fmt.Printf("Part 1: %s\n", part1(common.OpenInputFile()))
+		fmt.Printf("Part 2: %s\n", part2(common.OpenInputFile()))
+	}
 }
 
-func applyMask(val int, mask string) int {
-	for i, c := range mask {
-		switch c {
-		case 'X':
-			// ignore
-		case '1':
-			val = setBit(val, uint(35-i))
-		case '0':
-			val = clearBit(val, uint(35-i))
-		}
+// Loads the program named by the only argument left after the flags
+func loadSubcommandProgram(flags *flag.FlagSet, args []string) []instruction {
+	common.MustNotError(flags.Parse(args))
+	if flags.NArg() != 1 {
+		log.Fatal(usage)
 	}
-	return val
-}
+	file, err := os.Open(flags.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
 
-func clearBit(n int, i uint) int {
-	n &^= 1 << i
-	return n
+	program, err := loadProgram(file)
+	common.MustNotError(err)
+	return program
 }
 
-func setBit(n int, i uint) int {
-	n |= (1 << i)
-	return n
-}
+func runDump(args []string) {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	after := flags.Int("after", -1, "dump memory after this many instructions (default the whole program)")
+	width := flags.Int("width", defaultWidth, "the word width in bits")
+	wide := flags.Bool("big", false, "hold values as big integers, even when they fit in 64 bits")
+	program := loadSubcommandProgram(flags, args)
+	if *after < 0 {
+		*after = len(program)
+	}
 
-type memAssign struct {
-	location int
-	value    int
+	snaps, err := snapshotsOf(program, *width, *wide, *after)
+	common.MustNotError(err)
+	snaps[0].dump(os.Stdout)
 }
 
-var memAssignRegex = regexp.MustCompile(`mem\[(\d+)\]\s*=\s*(\d+)`)
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	from := flags.Int("from", 0, "the first snapshot, after this many instructions")
+	to := flags.Int("to", -1, "the second snapshot, after this many instructions (default the whole program)")
+	width := flags.Int("width", defaultWidth, "the word width in bits")
+	wide := flags.Bool("big", false, "hold values as big integers, even when they fit in 64 bits")
+	program := loadSubcommandProgram(flags, args)
+	if *to < 0 {
+		*to = len(program)
+	}
 
-func processMem(line string) memAssign {
-	results := memAssignRegex.FindStringSubmatch(line)
-	if len(results) < 3 {
-		log.Fatalf("unexpected format for mem assign %s: %v\n", line, results)
+	snaps, err := snapshotsOf(program, *width, *wide, *from, *to)
+	common.MustNotError(err)
+	changes := diffSnapshots(snaps[0], snaps[1])
+	fmt.Printf("%d addresses changed between instructions %d and %d\n", len(changes), *from, *to)
+	for _, ch := range changes {
+		fmt.Println(ch)
 	}
+}
 
-	l, err := strconv.Atoi(results[1])
+func part1(reader io.Reader) *big.Int {
+	program, err := loadProgram(reader)
 	common.MustNotError(err)
-	v, err := strconv.Atoi(results[2])
+	c, err := newComputer(programWidth(program), false)
 	common.MustNotError(err)
-	return memAssign{
-		location: l,
-		value:    v,
+	common.MustNotError(c.run(program))
+
+	return c.snapshot().sum()
+}
+
+// The word width of a program is the length of its masks, or the default for a program without any
+func programWidth(program []instruction) int {
+	for _, inst := range program {
+		if inst.kind == setMask {
+			return len(inst.mask)
+		}
 	}
+	return defaultWidth
 }
 
-func part2(reader io.Reader) int {
+func part2(reader io.Reader) *big.Int {
+	program, err := loadProgram(reader)
+	common.MustNotError(err)
+
 	var mask string
-	mem := make(map[int]int)
-	common.ScanLines(reader, func(line string) {
-		if strings.Contains(line, "mask") {
-			mask = strings.Fields(line)[2]
-		} else {
-			ma := processMem(line)
-			memUpdates := applyMask2(ma, mask)
-			for _, ma := range memUpdates {
-				mem[ma.location] = ma.value
+	mem := newFloatingMemory()
+	for _, inst := range program {
+		switch inst.kind {
+		case setMask:
+			mask = inst.mask
+		case writeMem:
+			if !inst.value.IsUint64() {
+				log.Fatalf("value %s doesn't fit in 64 bits", inst.value)
 			}
+			mem.write(floatingAddress(inst.addr, mask), inst.value.Uint64())
 		}
-	})
-
-	sum := 0
-	for _, val := range mem {
-		sum += val
 	}
 
-	return sum
+	return mem.sum()
+}
+
+// A set of addresses, where the floating bits can be either 0 or 1
+type addrPattern struct {
+	value    uint64 // the fixed bits (floating bits are always 0 here)
+	floating uint64 // the floating bits
+}
+
+// The number of addresses matched by the pattern
+func (p addrPattern) size() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits.OnesCount64(p.floating)))
+}
+
+// Checks whether any address matches both patterns
+func (p addrPattern) overlaps(o addrPattern) bool {
+	fixedInBoth := ^(p.floating | o.floating)
+	return (p.value^o.value)&fixedInBoth == 0
 }
 
-func applyMask2(val memAssign, mask string) []memAssign {
-	var results []memAssign
+// Removes the addresses of another pattern, leaving a set of patterns that don't overlap each other
+//
+// Each bit that floats here but is fixed in the other pattern splits off the half that can't overlap,
+// so there are at most as many pieces as floating bits
+func (p addrPattern) subtract(o addrPattern) []addrPattern {
+	if !p.overlaps(o) {
+		return []addrPattern{p}
+	}
+
+	var pieces []addrPattern
+	rest := p
+	split := p.floating &^ o.floating
+	for split != 0 {
+		bit := split & -split // lowest bit
+		split &^= bit
+
+		// the half where this bit differs from the other pattern
+		rest.floating &^= bit
+		pieces = append(pieces, addrPattern{value: rest.value | (^o.value & bit), floating: rest.floating})
+
+		// carry on with the half where it matches
+		rest.value |= o.value & bit
+	}
+
+	// whatever is left is entirely inside the other pattern
+	return pieces
+}
 
-	locations := []int{val.location}
+// Applies a version 2 mask to an address, 1s overwrite the address and Xs float
+func floatingAddress(location uint64, mask string) addrPattern {
+	var ones, floating uint64
 	for i, c := range mask {
+		bit := uint64(1) << uint(len(mask)-1-i)
 		switch c {
 		case 'X':
-			var newLocations []int
-			for j := 0; j < len(locations); j++ {
-				newLocations = append(newLocations, clearBit(locations[j], uint(35-i)))
-				locations[j] = setBit(locations[j], uint(35-i))
-			}
-			locations = append(locations, newLocations...)
+			floating |= bit
 		case '1':
-			for j := 0; j < len(locations); j++ {
-				locations[j] = setBit(locations[j], uint(35-i))
-			}
-		case '0':
-			// do nothing
+			ones |= bit
 		}
 	}
+	return addrPattern{value: (location | ones) &^ floating, floating: floating}
+}
 
-	for _, l := range locations {
-		results = append(results, memAssign{
-			location: l,
-			value:    val.value,
-		})
+// Memory written through floating addresses, kept as disjoint address patterns rather than every single address
+type floatingMemory struct {
+	regions []memRegion
+}
+
+type memRegion struct {
+	addrs addrPattern
+	value uint64
+}
+
+func newFloatingMemory() *floatingMemory {
+	return &floatingMemory{}
+}
+
+// Writes the value to every address matched by the pattern
+func (m *floatingMemory) write(addrs addrPattern, value uint64) {
+	var regions []memRegion
+	for _, r := range m.regions {
+		for _, piece := range r.addrs.subtract(addrs) {
+			regions = append(regions, memRegion{addrs: piece, value: r.value})
+		}
 	}
+	m.regions = append(regions, memRegion{addrs: addrs, value: value})
+}
 
-	return results
+// Adds up every value in memory
+func (m *floatingMemory) sum() *big.Int {
+	total := new(big.Int)
+	for _, r := range m.regions {
+		total.Add(total, new(big.Int).Mul(r.addrs.size(), new(big.Int).SetUint64(r.value)))
+	}
+	return total
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const (
+	example1 = `mask = XXXXXXXXXXXXXXXXXXXXXXXXXXXXX1XXXX0X
+mem[8] = 11
+mem[7] = 101
+mem[8] = 0`
+	example2 = `mask = 000000000000000000000000000000X1001X
+mem[42] = 100
+mask = 00000000000000000000000000000000X0XX
+mem[26] = 1`
+)
+
+func TestPart1(t *testing.T) {
+	t.Parallel()
+	want := big.NewInt(165)
+	if got := part1(strings.NewReader(example1)); want.Cmp(got) != 0 {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+
+	// 64 bit words, where the sum of two values is past 2^63
+	wide := "mask = " + strings.Repeat("X", 63) + "1\nmem[1] = 18446744073709551614\nmem[2] = 9223372036854775808"
+	want, _ = new(big.Int).SetString("27670116110564327424", 10)
+	if got := part1(strings.NewReader(wide)); want.Cmp(got) != 0 {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+}
+
+func TestPart2(t *testing.T) {
+	t.Parallel()
+	want := big.NewInt(208)
+	if got := part2(strings.NewReader(example2)); want.Cmp(got) != 0 {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+
+	// every one of the 2^36 addresses holds the largest 36 bit value
+	allX := "mask = " + strings.Repeat("X", 36) + "\nmem[0] = 68719476735"
+	want = new(big.Int).Lsh(big.NewInt(1<<36-1), 36)
+	if got := part2(strings.NewReader(allX)); want.Cmp(got) != 0 {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+}
+
+// The original implementation, expanding every floating bit into concrete addresses
+func expandAddresses(location int, mask string) []int {
+	locations := []int{location}
+	for i, c := range mask {
+		bit := 1 << uint(35-i)
+		switch c {
+		case 'X':
+			var newLocations []int
+			for j := 0; j < len(locations); j++ {
+				newLocations = append(newLocations, locations[j]&^bit)
+				locations[j] |= bit
+			}
+			locations = append(locations, newLocations...)
+		case '1':
+			for j := 0; j < len(locations); j++ {
+				locations[j] |= bit
+			}
+		case '0':
+			// do nothing
+		}
+	}
+
+	return locations
+}
+
+// Generates a random mask with a few floating bits
+func randomMask(rng *rand.Rand) string {
+	mask := []byte(strings.Repeat("0", 36))
+	for i := range mask {
+		switch rng.Intn(8) {
+		case 0:
+			mask[i] = 'X'
+		case 1, 2:
+			mask[i] = '1'
+		}
+	}
+	// keep the expansion small enough to compare against
+	for strings.Count(string(mask), "X") > 9 {
+		mask[strings.IndexByte(string(mask), 'X')] = '0'
+	}
+	return string(mask)
+}
+
+func TestMatchesExpansion(t *testing.T) {
+	t.Parallel()
+	rng := rand.New(rand.NewSource(14))
+	for round := 0; round < 20; round++ {
+		symbolic := newFloatingMemory()
+		expanded := make(map[int]int)
+
+		mask := randomMask(rng)
+		for i := 0; i < 50; i++ {
+			if rng.Intn(5) == 0 {
+				mask = randomMask(rng)
+			}
+			location, value := rng.Intn(1<<12), rng.Intn(1000)
+			symbolic.write(floatingAddress(uint64(location), mask), uint64(value))
+			for _, addr := range expandAddresses(location, mask) {
+				expanded[addr] = value
+			}
+		}
+
+		want := 0
+		for _, val := range expanded {
+			want += val
+		}
+		if got := symbolic.sum(); got.Cmp(big.NewInt(int64(want))) != 0 {
+			t.Fatalf("round %d: expected %d got %s\n", round, want, got)
+		}
+	}
+}
+
+func TestAllFloating(t *testing.T) {
+	t.Parallel()
+	mem := newFloatingMemory()
+	allX := strings.Repeat("X", 36)
+	mem.write(floatingAddress(0, allX), 1<<35)
+	mem.write(floatingAddress(5, strings.Repeat("0", 35)+"1"), 3)
+
+	// every one of the 2^36 addresses holds 2^35, apart from address 5, which holds 3
+	want := new(big.Int).Lsh(big.NewInt(1), 71)
+	want.Sub(want, big.NewInt(1<<35-3))
+	if got := mem.sum(); got.Cmp(want) != 0 {
+		t.Errorf("expected %s got %s\n", want, got)
+	}
+	if len(mem.regions) > 37 {
+		t.Errorf("expected at most 37 regions got %d\n", len(mem.regions))
+	}
+}
+
+func mustLoadProgram(t *testing.T, text string) []instruction {
+	program, err := loadProgram(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func TestWordWidth(t *testing.T) {
+	t.Parallel()
+	conditions := []struct {
+		program string
+		width   int
+		wide    bool
+		sum     string
+		err     bool
+	}{
+		{program: example1, width: 36, sum: "165"},
+		{program: example1, width: 36, wide: true, sum: "165"},
+		{program: "mask = X1X0\nmem[3] = 9\nmem[2] = 3", width: 4, sum: "18"},
+		{program: "mask = X1X0\nmem[3] = 9\nmem[2] = 3", width: 5, err: true},
+		{program: "mask = XX\nmem[3] = 9", width: 2, err: true},
+		{program: "mask = XX\nmem[4] = 1", width: 2, err: true},
+		// wider than 64 bits, so the sum is far past what an int can hold
+		{program: "mask = 1" + strings.Repeat("X", 79) + "\nmem[1] = 0\nmem[2] = 1", width: 80, sum: "1208925819614629174706177"},
+		// every value uses all 64 bits, so the sum overflows a uint64
+		{program: "mask = 1" + strings.Repeat("X", 63) + "\nmem[1] = 0\nmem[2] = 0", width: 64, sum: "18446744073709551616"},
+	}
+
+	for i, c := range conditions {
+		program := mustLoadProgram(t, c.program)
+		snaps, err := snapshotsOf(program, c.width, c.wide, len(program))
+		if c.err {
+			if err == nil {
+				t.Errorf("Example %d: expected an error\n", i+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Example %d: unexpected error %v\n", i+1, err)
+			continue
+		}
+		if got := snaps[0].sum().String(); got != c.sum {
+			t.Errorf("Example %d: expected %s got %s\n", i+1, c.sum, got)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	t.Parallel()
+	program := mustLoadProgram(t, example1)
+	snaps, err := snapshotsOf(program, defaultWidth, false, 0, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := diffSnapshots(snaps[1], snaps[2])
+	want := []string{"mem[7]: unset -> 101", "mem[8]: 73 -> 64"}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes got %v\n", len(want), changes)
+	}
+	for i := range want {
+		if got := changes[i].String(); got != want[i] {
+			t.Errorf("Change %d: expected %q got %q\n", i+1, want[i], got)
+		}
+	}
+	if changes := diffSnapshots(snaps[2], snaps[2]); len(changes) != 0 {
+		t.Errorf("expected no changes got %v\n", changes)
+	}
+	if len(snaps[0].mem) != 0 {
+		t.Errorf("expected empty memory before the program runs got %v\n", snaps[0].mem)
+	}
+
+	var sb strings.Builder
+	snaps[2].dump(&sb)
+	wantDump := `after 4 instructions, 2 addresses, sum 165
+000000007: 0x000000065 0b000000000000000000000000000001100101 (101)
+000000008: 0x000000040 0b000000000000000000000000000001000000 (64)
+`
+	if got := sb.String(); got != wantDump {
+		t.Errorf("expected dump\n%s\ngot\n%s\n", wantDump, got)
+	}
+
+	if _, err := snapshotsOf(program, defaultWidth, false, 5); err == nil {
+		t.Errorf("expected an error for a step past the end of the program\n")
+	}
+}
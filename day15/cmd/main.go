@@ -1,14 +1,90 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	common "github.com/torbensky/adventofcode-common"
 )
 
-var testInput = []int{}
+// Games up to this many numbers remember them in a flat slice, bigger ones fall back to a map
+const maxDense = 1 << 27
 
 func main() {
-	fmt.Printf("Part 1: %d\n", part1(testInput))
-	fmt.Printf("Part 2: %d\n", part2(testInput))
+	numbers := flag.String("numbers", "", "the starting numbers, e.g. \"0,3,6\", instead of reading them from an input file")
+	turns := flag.Int("turns", 0, "find the number spoken on this turn instead of solving both parts")
+	sequence := flag.Bool("sequence", false, "print every number spoken up to -turns (default 2020)")
+	memory := flag.String("memory", "auto", "how spoken numbers are remembered: \"auto\", \"dense\" or \"sparse\"")
+	flag.Parse()
+
+	var vals []int
+	var err error
+	switch {
+	case *numbers != "" && flag.NArg() == 0:
+		vals, err = parseNumbers(*numbers)
+	case *numbers == "" && flag.NArg() == 1:
+		file, openErr := os.Open(flag.Arg(0))
+		common.MustNotError(openErr)
+		defer file.Close()
+		vals, err = loadNumbers(file)
+	default:
+		log.Fatal("This command accepts either the path to the input file or the -numbers flag")
+	}
+	common.MustNotError(err)
+
+	mode, err := parseMemoryMode(*memory)
+	common.MustNotError(err)
+
+	if *sequence {
+		if *turns == 0 {
+			*turns = 2020
+		}
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		_, err := play(vals, *turns, mode, func(turn, n int) {
+			fmt.Fprintf(out, "%d: %d\n", turn, n)
+		})
+		common.MustNotError(err)
+		return
+	}
+
+	if *turns != 0 {
+		n, err := play(vals, *turns, mode, nil)
+		common.MustNotError(err)
+		fmt.Printf("Turn %d: %d\n", *turns, n)
+		return
+	}
+
+	fmt.Printf("Part 1: %d\n", part1(vals))
+	fmt.Printf("Part 2: %d\n", part2(vals))
+}
+
+// Parses comma separated starting numbers
+func parseNumbers(text string) ([]int, error) {
+	var vals []int
+	for _, field := range strings.Split(strings.TrimSpace(text), ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad starting number %q", field)
+		}
+		vals = append(vals, n)
+	}
+	return vals, nil
+}
+
+func loadNumbers(reader io.Reader) ([]int, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return parseNumbers(string(data))
 }
 
 func part1(vals []int) int {
@@ -20,19 +96,103 @@ func part2(vals []int) int {
 }
 
 func playSayGame(vals []int, numTurns int) int {
-	initialLength := len(vals)
-	spoken := make(map[int]int)
-	for i, s := range vals[:initialLength-1] {
-		spoken[s] = i + 1
+	n, err := play(vals, numTurns, auto, nil)
+	common.MustNotError(err)
+	return n
+}
+
+// How the game remembers when each number was last spoken
+type memoryMode int
+
+const (
+	auto   memoryMode = iota // dense when the game has few enough turns
+	dense                    // a slice indexed by number, with a map for starting numbers past the last turn
+	sparse                   // a map, for games with huge numbers
+)
+
+func parseMemoryMode(name string) (memoryMode, error) {
+	switch name {
+	case "auto":
+		return auto, nil
+	case "dense":
+		return dense, nil
+	case "sparse":
+		return sparse, nil
 	}
-	last := vals[initialLength-1]
-	for turn := initialLength; turn < numTurns; turn++ {
+	return auto, fmt.Errorf("unknown memory mode %q", name)
+}
+
+// Plays the game until the given turn, returning the number spoken on that turn
+//
+// Each number spoken is passed to emit (when it isn't nil), along with its turn, starting from turn 1
+func play(vals []int, numTurns int, mode memoryMode, emit func(turn, n int)) (int, error) {
+	if len(vals) == 0 {
+		return 0, fmt.Errorf("the game needs at least one starting number")
+	}
+	if numTurns < 1 {
+		return 0, fmt.Errorf("the game needs at least one turn, got %d", numTurns)
+	}
+
+	for _, v := range vals {
+		if v < 0 {
+			return 0, fmt.Errorf("bad starting number %d", v)
+		}
+	}
+	if mode == auto {
+		mode = dense
+		if numTurns > maxDense {
+			mode = sparse
+		}
+	}
+	if mode == dense && int64(numTurns) > 1<<31-1 {
+		return 0, fmt.Errorf("a dense game can't remember turns past %d", 1<<31-1)
+	}
+
+	// A number spoken on a turn is always smaller than the turn, unless it is a starting number
+	g := newGame(numTurns, mode == dense)
+	last := vals[0]
+	for turn := 1; turn <= numTurns; turn++ {
 		next := 0
-		if val, ok := spoken[last]; ok {
-			next = turn - val
+		if turn > 1 {
+			// the previous number is only remembered now, so it doesn't find itself
+			if prev := g.say(last, turn-1); prev != 0 {
+				next = turn - 1 - prev
+			}
+		}
+		if turn <= len(vals) {
+			next = vals[turn-1]
 		}
-		spoken[last] = turn
 		last = next
+		if emit != nil {
+			emit(turn, last)
+		}
+	}
+
+	return last, nil
+}
+
+// Remembers the last turn each number was spoken on
+type game struct {
+	dense  []int32     // indexed by number, 0 when it hasn't been spoken
+	sparse map[int]int // the numbers too big for dense, which is every number in a sparse game
+}
+
+func newGame(size int, dense bool) *game {
+	g := &game{sparse: make(map[int]int)}
+	if dense {
+		g.dense = make([]int32, size)
+	}
+	return g
+}
+
+// Records that n was spoken on the turn, returning the turn it was previously spoken on (or 0)
+func (g *game) say(n, turn int) int {
+	if n < len(g.dense) {
+		prev := g.dense[n]
+		g.dense[n] = int32(turn)
+		return int(prev)
 	}
-	return last
+	prev := g.sparse[n]
+	g.sparse[n] = turn
+	return prev
 }
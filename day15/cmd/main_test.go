@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPart1(t *testing.T) {
+	t.Parallel()
+	conditions := []struct {
+		input    string
+		expected int
+	}{
+		{"0,3,6", 436},
+		{"1,3,2", 1},
+		{"2,1,3", 10},
+		{"1,2,3", 27},
+		{"2,3,1", 78},
+		{"3,2,1", 438},
+		{"3,1,2", 1836},
+	}
+
+	for i, c := range conditions {
+		vals, err := loadNumbers(strings.NewReader(c.input + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := part1(vals); result != c.expected {
+			t.Errorf("Example %d: expected %d got %d\n", i+1, c.expected, result)
+		}
+	}
+}
+
+func TestPart2(t *testing.T) {
+	if testing.Short() {
+		t.Skip("30 million turns")
+	}
+	if result := part2([]int{0, 3, 6}); result != 175594 {
+		t.Errorf("expected %d got %d\n", 175594, result)
+	}
+}
+
+func TestMemoryModes(t *testing.T) {
+	t.Parallel()
+	conditions := []struct {
+		vals  []int
+		turns int
+	}{
+		{[]int{0, 3, 6}, 1},
+		{[]int{0, 3, 6}, 2},
+		{[]int{0, 3, 6}, 4},
+		{[]int{0, 3, 6}, 10000},
+		{[]int{1, 1, 1}, 50},
+		{[]int{7}, 100},
+		// huge starting numbers, which a dense game keeps in its map
+		{[]int{0, 1 << 40, 5}, 1000},
+		{[]int{100000000, 3, 100000000}, 10},
+	}
+
+	for i, c := range conditions {
+		s, err := play(c.vals, c.turns, sparse, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mode := range []memoryMode{auto, dense} {
+			d, err := play(c.vals, c.turns, mode, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != s {
+				t.Errorf("Example %d: mode %d got %d sparse got %d\n", i+1, mode, d, s)
+			}
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	t.Parallel()
+	var spoken []int
+	last, err := play([]int{0, 3, 6}, 10, auto, func(turn, n int) {
+		if turn != len(spoken)+1 {
+			t.Errorf("expected turn %d got %d\n", len(spoken)+1, turn)
+		}
+		spoken = append(spoken, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{0, 3, 6, 0, 3, 3, 1, 0, 4, 0}
+	for i := range expected {
+		if spoken[i] != expected[i] {
+			t.Errorf("Turn %d: expected %d got %d\n", i+1, expected[i], spoken[i])
+		}
+	}
+	if last != 0 {
+		t.Errorf("expected %d got %d\n", 0, last)
+	}
+}
+
+func TestBadInput(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"", "1,,2", "1,-2", "a"} {
+		if _, err := parseNumbers(input); err == nil {
+			t.Errorf("expected an error for %q\n", input)
+		}
+	}
+	if _, err := play(nil, 10, auto, nil); err == nil {
+		t.Errorf("expected an error without starting numbers\n")
+	}
+	if _, err := play([]int{1}, 1<<31, dense, nil); err == nil {
+		t.Errorf("expected an error for a dense game with too many turns\n")
+	}
+}
+
+func BenchmarkDense(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		play([]int{0, 3, 6}, 1000000, dense, nil)
+	}
+}
+
+func BenchmarkSparse(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		play([]int{0, 3, 6}, 1000000, sparse, nil)
+	}
+}
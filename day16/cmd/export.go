@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The names of the ticket's columns, in column order
+func columnNames(identified map[int]string, columns int) []string {
+	names := make([]string, columns)
+	for col := range names {
+		name, ok := identified[col]
+		if !ok {
+			name = fmt.Sprintf("column %d", col)
+		}
+		names[col] = name
+	}
+	return names
+}
+
+// Writes your ticket followed by the valid nearby tickets as CSV, with a header row of field names
+func writeCSV(w io.Writer, identified map[int]string, yourTicket ticket, tickets []ticket) error {
+	out := csv.NewWriter(w)
+	header := append([]string{"ticket"}, columnNames(identified, len(yourTicket.values))...)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, t := range append([]ticket{yourTicket}, tickets...) {
+		if len(t.values) != len(header)-1 {
+			return fmt.Errorf("%s has %d values but there are %d columns", t.label(), len(t.values), len(header)-1)
+		}
+		row := []string{t.label()}
+		for _, val := range t.values {
+			row = append(row, strconv.Itoa(val))
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// Writes your ticket followed by the valid nearby tickets as a JSON array, with the values keyed by field name
+func writeJSON(w io.Writer, identified map[int]string, yourTicket ticket, tickets []ticket) error {
+	type namedTicket struct {
+		Ticket string         `json:"ticket"`
+		Fields map[string]int `json:"fields"`
+	}
+
+	names := columnNames(identified, len(yourTicket.values))
+	var result []namedTicket
+	for _, t := range append([]ticket{yourTicket}, tickets...) {
+		if len(t.values) != len(names) {
+			return fmt.Errorf("%s has %d values but there are %d columns", t.label(), len(t.values), len(names))
+		}
+		nt := namedTicket{Ticket: t.label(), Fields: make(map[string]int)}
+		for col, val := range t.values {
+			nt.Fields[names[col]] = val
+		}
+		result = append(result, nt)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// A set of fields, where each field is a bit numbered by its position in the fieldIndex
+type fieldBits []uint64
+
+func newFieldBits(fields int) fieldBits {
+	return make(fieldBits, (fields+63)/64)
+}
+
+func (b fieldBits) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b fieldBits) clear(i int) {
+	b[i/64] &^= 1 << uint(i%64)
+}
+
+func (b fieldBits) has(i int) bool {
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
+
+// Keeps only the fields that are also in o
+func (b fieldBits) and(o fieldBits) {
+	for i := range b {
+		b[i] &= o[i]
+	}
+}
+
+func (b fieldBits) count() int {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// The lowest field in the set, or -1 when it is empty
+func (b fieldBits) first() int {
+	for i, w := range b {
+		if w != 0 {
+			return i*64 + bits.TrailingZeros64(w)
+		}
+	}
+	return -1
+}
+
+func (b fieldBits) clone() fieldBits {
+	return append(fieldBits(nil), b...)
+}
+
+// Finds the fields matching a value without checking every field's ranges
+//
+// The boundaries of every range are swept in order, splitting the numbers into intervals where the same
+// fields match. Looking up a value is then a binary search for its interval.
+type fieldIndex struct {
+	names  []string    // the fields in name order, a field's bit is its position here
+	bounds []int       // values in [bounds[i], bounds[i+1]) match sets[i]
+	sets   []fieldBits // the last set is always empty, as no range goes on forever
+	none   fieldBits   // matched by values before the first boundary
+}
+
+func newFieldIndex(schema ticketSchema) *fieldIndex {
+	ix := &fieldIndex{}
+	for name := range schema {
+		ix.names = append(ix.names, name)
+	}
+	sort.Strings(ix.names)
+	ix.none = newFieldBits(len(ix.names))
+
+	// a field starts matching at the start of a range and stops right after its end
+	type event struct {
+		at    int
+		field int
+		delta int
+	}
+	var events []event
+	for field, name := range ix.names {
+		for _, r := range schema[name] {
+			events = append(events, event{r.start, field, 1}, event{r.end + 1, field, -1})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].at < events[j].at })
+
+	active := make([]int, len(ix.names))
+	current := newFieldBits(len(ix.names))
+	for i := 0; i < len(events); {
+		at := events[i].at
+		for ; i < len(events) && events[i].at == at; i++ {
+			e := events[i]
+			active[e.field] += e.delta
+			if active[e.field] > 0 {
+				current.set(e.field)
+			} else {
+				current.clear(e.field)
+			}
+		}
+		ix.bounds = append(ix.bounds, at)
+		ix.sets = append(ix.sets, current.clone())
+	}
+
+	return ix
+}
+
+// The fields matching the value, which must not be modified
+func (ix *fieldIndex) lookup(val int) fieldBits {
+	i := sort.Search(len(ix.bounds), func(i int) bool { return ix.bounds[i] > val }) - 1
+	if i < 0 {
+		return ix.none
+	}
+	return ix.sets[i]
+}
+
+// The names of the fields in the set, in name order
+func (ix *fieldIndex) namesOf(b fieldBits) []string {
+	var names []string
+	for field, name := range ix.names {
+		if b.has(field) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// The position of the field, or -1 when it isn't in the schema
+func (ix *fieldIndex) field(name string) int {
+	i := sort.SearchStrings(ix.names, name)
+	if i < len(ix.names) && ix.names[i] == name {
+		return i
+	}
+	return -1
+}
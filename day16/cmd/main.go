@@ -1,35 +1,55 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"sort"
 	"strings"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
 func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
-}
-
-type fieldSet map[string]struct{}
-
-// returns a set that is the intersection of sets a and b
-func intersect(a, b fieldSet) fieldSet {
-	result := make(fieldSet)
+	listInvalid := flag.Bool("invalid", false, "list every invalid value on the nearby tickets")
+	export := flag.String("export", "", "print the valid tickets with named columns as \"csv\" or \"json\"")
+	flag.Parse()
 
-	for k := range a {
-		if _, ok := b[k]; ok {
-			result[k] = struct{}{}
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+	schema, tickets, yourTicket, invalid := loadTicketData(file)
+
+	if *listInvalid {
+		for _, inv := range invalid {
+			fmt.Println(inv)
 		}
+		return
 	}
 
-	return result
+	identified, err := identifyFields(schema, tickets)
+	common.MustNotError(err)
+	switch *export {
+	case "":
+		fmt.Printf("Part 1: %d\n", errorRate(invalid))
+		fmt.Printf("Part 2: %d\n", departureProduct(identified, yourTicket))
+	case "csv":
+		common.MustNotError(writeCSV(os.Stdout, identified, yourTicket, tickets))
+	case "json":
+		common.MustNotError(writeJSON(os.Stdout, identified, yourTicket, tickets))
+	default:
+		log.Fatalf("unknown export format %q", *export)
+	}
 }
 
-type ticketSchema map[string][2]fieldRange
+// The valid ranges of each field, sorted and merged so that none of them overlap
+type ticketSchema map[string][]fieldRange
 
 func (ts ticketSchema) print() {
 	for k, v := range ts {
@@ -42,26 +62,27 @@ func (ts ticketSchema) print() {
 }
 
 func (ts ticketSchema) findFields(t ticket, column int) []string {
-	var fields []string
-
-	for label := range t.rules[column] {
-		fields = append(fields, label)
-	}
-
-	return fields
+	return t.fields.namesOf(t.rules[column])
 }
 
-func loadTicketData(reader io.Reader) (ticketSchema, []ticket, ticket, int) {
+// Loads the schema and tickets, returning only the nearby tickets that are valid along with every invalid value
+func loadTicketData(reader io.Reader) (ticketSchema, []ticket, ticket, []invalidValue) {
 
 	schema := make(ticketSchema)
 	var yourTicket ticket
 	var validTickets []ticket
+	var invalid []invalidValue
 
-	scanningErrors := 0
+	var index *fieldIndex
+	nearby := 0
 	scanMode := 0
 	common.ScanLines(reader, func(line string) {
 
 		if line == "" {
+			if scanMode == 0 {
+				// the schema is complete
+				index = newFieldIndex(schema)
+			}
 			scanMode++
 			return
 		}
@@ -77,7 +98,7 @@ func loadTicketData(reader io.Reader) (ticketSchema, []ticket, ticket, int) {
 		case 2:
 			// Your ticket data "7,1,14"
 			// parse data for our ticket
-			tikt, _, _ := readTicketData(schema, line)
+			tikt, _ := readTicketData(index, line)
 			// "your ticket" should always be valid
 			yourTicket = tikt
 			// our ticket  == valid
@@ -87,57 +108,68 @@ func loadTicketData(reader io.Reader) (ticketSchema, []ticket, ticket, int) {
 			scanMode++
 		case 4:
 			// scan nearby ticket data to the end of the file
-			tikt, valid, errors := readTicketData(schema, line)
-			if valid {
+			nearby++
+			tikt, bad := readTicketData(index, line)
+			tikt.nearby = nearby
+			if len(bad) == 0 {
 				validTickets = append(validTickets, tikt)
-			} else {
-				scanningErrors += errors
+			}
+			for _, inv := range bad {
+				inv.ticket = nearby
+				invalid = append(invalid, inv)
 			}
 		default:
 			log.Fatal("unhandled scan mode encountered")
 		}
 	})
 
-	return schema, validTickets, yourTicket, scanningErrors
+	return schema, validTickets, yourTicket, invalid
 }
 
 func part1(reader io.Reader) int {
-	_, _, _, errors := loadTicketData(reader)
-	return errors
+	_, _, _, invalid := loadTicketData(reader)
+	return errorRate(invalid)
 }
 
-func findFieldMatches(fields ticketSchema, val int) fieldSet {
-	matches := make(fieldSet)
-	for label, ranges := range fields {
-		for _, r := range ranges {
-			if val >= r.start && val <= r.end {
-				// fmt.Printf("valid match found\n")
-				// valid field match
-				matches[label] = struct{}{}
-			}
-		}
-	}
+// A value on a nearby ticket that doesn't match any field
+type invalidValue struct {
+	ticket int // the nearby ticket, counting from 1
+	column int
+	value  int
+}
+
+func (inv invalidValue) String() string {
+	return fmt.Sprintf("nearby ticket %d, column %d: %d", inv.ticket, inv.column, inv.value)
+}
 
-	// no fields match
-	return matches
+// The ticket scanning error rate, the sum of the invalid values
+func errorRate(invalid []invalidValue) int {
+	rate := 0
+	for _, inv := range invalid {
+		rate += inv.value
+	}
+	return rate
 }
 
-func parseFieldLine(line string) (string, [2]fieldRange) {
-	fields := strings.Fields(line)
+// Parses a field such as "class: 1-3 or 5-7", which can have any number of ranges
+func parseFieldLine(line string) (string, []fieldRange) {
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		log.Fatalf("unexpected fields data: %s\n", line)
+	}
+
 	var ranges []fieldRange
-	for _, f := range fields {
+	for _, f := range strings.Fields(parts[1]) {
 		if strings.Contains(f, "-") {
 			ranges = append(ranges, parseRange(f))
 		}
 	}
 
-	if len(ranges) != 2 {
+	if len(ranges) == 0 {
 		log.Fatalf("unexpected fields data: %s\n", line)
 	}
 
-	label := strings.Split(line, ":")[0]
-
-	return label, [2]fieldRange{ranges[0], ranges[1]}
+	return parts[0], mergeRanges(ranges)
 }
 
 type fieldRange struct {
@@ -154,12 +186,44 @@ func parseRange(rangeStr string) fieldRange {
 	rStart := common.Atoi(result[0])
 	rEnd := common.Atoi(result[1])
 
+	if rEnd < rStart {
+		log.Fatalf("range %s ends before it starts", rangeStr)
+	}
+
 	return fieldRange{start: rStart, end: rEnd}
 }
 
+// Sorts the ranges, merging any that overlap or touch
+func mergeRanges(ranges []fieldRange) []fieldRange {
+	sorted := append([]fieldRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.end+1 {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
 type ticket struct {
 	values []int
-	rules  columnRules
+	rules  []fieldBits // the fields matching each column
+	fields *fieldIndex
+	nearby int // the position among the nearby tickets counting from 1, or 0 for your ticket
+}
+
+func (t ticket) label() string {
+	if t.nearby == 0 {
+		return "your ticket"
+	}
+	return fmt.Sprintf("nearby ticket %d", t.nearby)
 }
 
 func (t ticket) print() {
@@ -171,76 +235,84 @@ func (t ticket) print() {
 
 // Attempts to parse the ticket from a line of data
 //
-// Returns the invalid value if the ticket is found to be invalid
-//
-// The ticket should be ignored if valid is false
-//
-func readTicketData(schema ticketSchema, line string) (ticket, bool, int) {
+// Returns every value that doesn't match any field, the ticket should be ignored if there are any
+func readTicketData(index *fieldIndex, line string) (ticket, []invalidValue) {
 	columns := strings.Split(line, ",")
-	t := ticket{rules: make(columnRules), values: make([]int, len(columns))}
+	t := ticket{rules: make([]fieldBits, len(columns)), values: make([]int, len(columns)), fields: index}
+	var invalid []invalidValue
 	for fieldPos, field := range columns {
 		val := common.Atoi(field)
-		matches := findFieldMatches(schema, val)
-		if len(matches) == 0 {
-			return t, false, val
-		}
 		t.values[fieldPos] = val
+		matches := index.lookup(val)
+		if matches.count() == 0 {
+			invalid = append(invalid, invalidValue{column: fieldPos, value: val})
+		}
 		t.rules[fieldPos] = matches
 	}
 
-	if len(t.rules) == len(columns) {
-		return t, true, -1
-	}
-
-	panic("somehow ended up with no invalidations but not enough matches")
+	return t, invalid
 }
 
-type columnRules map[int]fieldSet
+// The fields that could be in each column, narrowed down by every ticket
+type columnRules struct {
+	fields *fieldIndex
+	cols   []fieldBits
+}
 
 func (cr columnRules) countFields(col int) int {
-	return len(cr[col])
+	return cr.cols[col].count()
 }
 
 func (cr columnRules) deleteField(field string) {
-	for col := 0; col < len(cr); col++ {
-		delete(cr[col], field)
+	i := cr.fields.field(field)
+	for _, fields := range cr.cols {
+		fields.clear(i)
 	}
 }
 
 func (cr columnRules) identifyNext() (int, string) {
-	for col, fields := range cr {
-		if len(fields) == 1 {
-			for field := range fields {
-				return col, field
-			}
+	for col, fields := range cr.cols {
+		if fields.count() == 1 {
+			return col, cr.fields.names[fields.first()]
 		}
 	}
 
 	panic("bad state - unable to identify further fields")
 }
 
-func newColumnRules(tickets []ticket) columnRules {
-	rules := make(columnRules)
+// Finds the fields every ticket allows in each column, which needs every ticket to have the same columns
+func newColumnRules(tickets []ticket) (columnRules, error) {
+	var rules columnRules
+	if len(tickets) == 0 {
+		return rules, nil
+	}
 
-	for _, t := range tickets {
+	rules.fields = tickets[0].fields
+	for _, fields := range tickets[0].rules {
+		rules.cols = append(rules.cols, fields.clone())
+	}
+	for _, t := range tickets[1:] {
+		if len(t.rules) != len(rules.cols) {
+			return rules, fmt.Errorf("%s has %d columns but %s has %d", t.label(), len(t.rules), tickets[0].label(), len(rules.cols))
+		}
 		for col, fields := range t.rules {
-
-			if _, ok := rules[col]; !ok {
-				rules[col] = fields
-				continue
-			}
-
-			rules[col] = intersect(rules[col], fields)
+			rules.cols[col].and(fields)
 		}
 	}
 
-	return rules
+	return rules, nil
 }
 
 func part2(reader io.Reader) int {
 	schema, tickets, yourTicket, _ := loadTicketData(reader)
 
-	identified := identifyFields(schema, tickets)
+	identified, err := identifyFields(schema, tickets)
+	common.MustNotError(err)
+	return departureProduct(identified, yourTicket)
+}
+
+// Multiplies together the values of your ticket's departure fields
+func departureProduct(identified map[int]string, yourTicket ticket) int {
 	total := 1
 	for col, field := range identified {
 		if strings.HasPrefix(field, "departure") {
@@ -251,8 +323,11 @@ func part2(reader io.Reader) int {
 	return total
 }
 
-func identifyFields(schema ticketSchema, tickets []ticket) map[int]string {
-	cr := newColumnRules(tickets)
+func identifyFields(schema ticketSchema, tickets []ticket) (map[int]string, error) {
+	cr, err := newColumnRules(tickets)
+	if err != nil {
+		return nil, err
+	}
 	identified := make(map[int]string)
 	for {
 
@@ -265,5 +340,5 @@ func identifyFields(schema ticketSchema, tickets []ticket) map[int]string {
 		}
 	}
 
-	return identified
+	return identified, nil
 }
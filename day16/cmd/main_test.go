@@ -1,47 +1,41 @@
 package main
 
 import (
+	"fmt"
+	"math/rand"
 	"strings"
 	"testing"
+
+	common "github.com/torbensky/adventofcode-common"
 )
 
 func TestIntersect(t *testing.T) {
 
+	// bits for foo, bar and baz
+	set := func(fields ...int) fieldBits {
+		b := newFieldBits(3)
+		for _, f := range fields {
+			b.set(f)
+		}
+		return b
+	}
+
 	for _, c := range []struct {
-		a fieldSet
-		b fieldSet
+		a fieldBits
+		b fieldBits
 		l int
 	}{
-		{
-			a: fieldSet{"foo": struct{}{}, "bar": struct{}{}},
-			b: fieldSet{"bar": struct{}{}},
-			l: 1,
-		},
-		{
-			a: fieldSet{"foo": struct{}{}, "bar": struct{}{}},
-			b: fieldSet{"foo": struct{}{}, "bar": struct{}{}},
-			l: 2,
-		},
-		{
-			a: fieldSet{"foo": struct{}{}, "bar": struct{}{}, "baz": struct{}{}},
-			b: fieldSet{"bar": struct{}{}, "foo": struct{}{}},
-			l: 2,
-		},
-		{
-			a: fieldSet{"foo": struct{}{}, "bar": struct{}{}, "baz": struct{}{}},
-			b: fieldSet{},
-			l: 0,
-		},
-		{
-			a: fieldSet{},
-			b: fieldSet{},
-			l: 0,
-		},
+		{a: set(0, 1), b: set(1), l: 1},
+		{a: set(0, 1), b: set(0, 1), l: 2},
+		{a: set(0, 1, 2), b: set(1, 0), l: 2},
+		{a: set(0, 1, 2), b: set(), l: 0},
+		{a: set(), b: set(), l: 0},
 	} {
-		result := intersect(c.a, c.b)
-		got := len(result)
+		result := c.a.clone()
+		result.and(c.b)
+		got := result.count()
 		if c.l != got {
-			t.Fatalf("%v | %v failed: wanted %d got %d\n", c.a, c.b, c.l, len(result))
+			t.Fatalf("%v | %v failed: wanted %d got %d\n", c.a, c.b, c.l, got)
 		}
 	}
 }
@@ -49,7 +43,10 @@ func TestIntersect(t *testing.T) {
 func TestColumnRules(t *testing.T) {
 	_, tickets, _, _ := loadTicketData(strings.NewReader(example2))
 
-	cr := newColumnRules(tickets)
+	cr, err := newColumnRules(tickets)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	want := 1
 	if count := cr.countFields(0); want != count {
@@ -129,9 +126,9 @@ func TestFindFields(t *testing.T) {
 }
 
 func TestLoadData(t *testing.T) {
-	schema, tickets, yt, errors := loadTicketData(strings.NewReader(example1))
+	schema, tickets, yt, invalid := loadTicketData(strings.NewReader(example1))
 
-	if errors != 71 {
+	if errors := errorRate(invalid); errors != 71 {
 		t.Fatalf("wanted 71 got %d\n", errors)
 	}
 
@@ -148,11 +145,11 @@ func TestLoadData(t *testing.T) {
 
 	for _, c := range []struct {
 		field  string
-		ranges [2]fieldRange
+		ranges []fieldRange
 	}{
-		{field: "class", ranges: [2]fieldRange{{1, 3}, {5, 7}}},
-		{field: "row", ranges: [2]fieldRange{{6, 11}, {33, 44}}},
-		{field: "seat", ranges: [2]fieldRange{{13, 40}, {45, 50}}},
+		{field: "class", ranges: []fieldRange{{1, 3}, {5, 7}}},
+		{field: "row", ranges: []fieldRange{{6, 11}, {33, 44}}},
+		{field: "seat", ranges: []fieldRange{{13, 40}, {45, 50}}},
 	} {
 		if _, ok := schema[c.field]; !ok {
 			t.Fatalf("schema is missing field %s\n", c.field)
@@ -178,6 +175,210 @@ func TestLoadData(t *testing.T) {
 	}
 }
 
+func TestInvalidValues(t *testing.T) {
+	_, tickets, _, invalid := loadTicketData(strings.NewReader(example3))
+
+	want := []string{
+		"nearby ticket 2, column 1: 4",
+		"nearby ticket 3, column 0: 55",
+		"nearby ticket 4, column 1: 0",
+		"nearby ticket 4, column 2: 100",
+	}
+	if len(invalid) != len(want) {
+		t.Fatalf("wanted %d invalid values got %v\n", len(want), invalid)
+	}
+	for i := range want {
+		if got := invalid[i].String(); got != want[i] {
+			t.Errorf("wanted %q got %q\n", want[i], got)
+		}
+	}
+
+	if len(tickets) != 1 || tickets[0].nearby != 1 {
+		t.Fatalf("wanted only nearby ticket 1 to be valid got %v\n", tickets)
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	for i, c := range []struct {
+		line   string
+		ranges []fieldRange
+	}{
+		{line: "a: 1-3", ranges: []fieldRange{{1, 3}}},
+		{line: "a: 5-7 or 1-3", ranges: []fieldRange{{1, 3}, {5, 7}}},
+		{line: "a: 1-3 or 4-7", ranges: []fieldRange{{1, 7}}},
+		{line: "a: 1-10 or 2-3 or 12-15 or 9-11", ranges: []fieldRange{{1, 15}}},
+		{line: "arrival track: 1-2 or 8-9 or 4-5", ranges: []fieldRange{{1, 2}, {4, 5}, {8, 9}}},
+	} {
+		_, ranges := parseFieldLine(c.line)
+		if len(ranges) != len(c.ranges) {
+			t.Fatalf("Example %d: wanted %v got %v\n", i+1, c.ranges, ranges)
+		}
+		for j := range ranges {
+			if ranges[j] != c.ranges[j] {
+				t.Fatalf("Example %d: wanted %v got %v\n", i+1, c.ranges, ranges)
+			}
+		}
+		for val := 0; val <= 16; val++ {
+			want := false
+			for _, r := range c.ranges {
+				want = want || (val >= r.start && val <= r.end)
+			}
+			ix := newFieldIndex(ticketSchema{"a": ranges})
+			if got := ix.lookup(val).has(0); got != want {
+				t.Errorf("Example %d: %d wanted %t got %t\n", i+1, val, want, got)
+			}
+		}
+	}
+}
+
+func TestMismatchedColumns(t *testing.T) {
+	input := strings.Replace(example2, "15,1,5", "15,1", 1)
+	schema, tickets, _, _ := loadTicketData(strings.NewReader(input))
+	_, err := identifyFields(schema, tickets)
+	if want := "nearby ticket 2 has 2 columns but nearby ticket 1 has 3"; err == nil || err.Error() != want {
+		t.Errorf("wanted error %q got %v\n", want, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	schema, tickets, yt, _ := loadTicketData(strings.NewReader(example2))
+	identified, err := identifyFields(schema, tickets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err := writeCSV(&sb, identified, yt, tickets); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := `ticket,row,class,seat
+your ticket,11,12,13
+nearby ticket 1,3,9,18
+nearby ticket 2,15,1,5
+nearby ticket 3,5,14,9
+`
+	if got := sb.String(); got != wantCSV {
+		t.Errorf("wanted\n%s\ngot\n%s\n", wantCSV, got)
+	}
+
+	sb.Reset()
+	if err := writeJSON(&sb, identified, yt, tickets); err != nil {
+		t.Fatal(err)
+	}
+	if got := sb.String(); !strings.Contains(got, `"ticket": "your ticket"`) || !strings.Contains(got, `"seat": 13`) {
+		t.Errorf("unexpected JSON\n%s\n", got)
+	}
+}
+
+func TestFieldIndex(t *testing.T) {
+	schema := ticketSchema{}
+	for _, line := range []string{
+		"a: 1-3 or 5-7",
+		"b: 6-11 or 33-44",
+		"c: 0-0 or 13-40 or 45-50",
+		"d: 3-3",
+	} {
+		name, ranges := parseFieldLine(line)
+		schema[name] = ranges
+	}
+	ix := newFieldIndex(schema)
+
+	for val := -2; val <= 55; val++ {
+		var want []string
+		for _, name := range []string{"a", "b", "c", "d"} {
+			for _, r := range schema[name] {
+				if val >= r.start && val <= r.end {
+					want = append(want, name)
+					break
+				}
+			}
+		}
+		got := ix.namesOf(ix.lookup(val))
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("value %d: wanted %v got %v\n", val, want, got)
+		}
+	}
+}
+
+func TestManyFields(t *testing.T) {
+	// more fields than fit in one word, each matching a single value
+	schema := ticketSchema{}
+	for i := 0; i < 150; i++ {
+		schema[fmt.Sprintf("field %03d", i)] = []fieldRange{{start: i * 2, end: i * 2}}
+	}
+	ix := newFieldIndex(schema)
+	for i := 0; i < 150; i++ {
+		if got := ix.namesOf(ix.lookup(i * 2)); len(got) != 1 || got[0] != fmt.Sprintf("field %03d", i) {
+			t.Fatalf("value %d: got %v\n", i*2, got)
+		}
+		if got := ix.lookup(i*2 + 1).count(); got != 0 {
+			t.Fatalf("value %d: wanted no fields got %d\n", i*2+1, got)
+		}
+	}
+}
+
+// Generates a ticket file with the given number of fields and nearby tickets, where every column can be identified
+func generateTickets(fields, tickets int, seed int64) string {
+	rng := rand.New(rand.NewSource(seed))
+	var sb strings.Builder
+
+	// field i accepts 0-i*10+9 and a range of its own, so column i narrows down to fields >= i
+	for i := 0; i < fields; i++ {
+		fmt.Fprintf(&sb, "field %d: 0-%d or %d-%d\n", i, i*10+9, 100000+i*10, 100000+i*10+9)
+	}
+
+	// column i holds values only fields >= i accept
+	perm := rng.Perm(fields)
+	row := func() string {
+		vals := make([]string, fields)
+		for col, i := range perm {
+			vals[col] = fmt.Sprint(i*10 + rng.Intn(10))
+		}
+		return strings.Join(vals, ",")
+	}
+
+	fmt.Fprintf(&sb, "\nyour ticket:\n%s\n\nnearby tickets:\n", row())
+	for t := 0; t < tickets; t++ {
+		if t%10 == 0 {
+			sb.WriteString("99999\n")
+			continue
+		}
+		sb.WriteString(row())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func TestGenerated(t *testing.T) {
+	input := generateTickets(100, 200, 16)
+	schema, tickets, _, invalid := loadTicketData(strings.NewReader(input))
+	if len(invalid) != 20 {
+		t.Fatalf("wanted 20 invalid values got %d\n", len(invalid))
+	}
+
+	identified, err := identifyFields(schema, tickets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for col, field := range identified {
+		lowest := common.Atoi(strings.Fields(field)[1]) * 10
+		for _, tk := range tickets {
+			if tk.values[col] < lowest || tk.values[col] > lowest+9 {
+				t.Fatalf("column %d identified as %s holds %d\n", col, field, tk.values[col])
+			}
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	input := generateTickets(100, 10000, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		schema, tickets, _, _ := loadTicketData(strings.NewReader(input))
+		identifyFields(schema, tickets)
+	}
+}
+
 const example1 = `class: 1-3 or 5-7
 row: 6-11 or 33-44
 seat: 13-40 or 45-50
@@ -202,3 +403,17 @@ nearby tickets:
 3,9,18
 15,1,5
 5,14,9`
+
+const example3 = `class: 1-3 or 5-7 or 60-70
+row: 6-11 or 33-44
+seat: 13-40 or 45-50 or 65-99
+
+your ticket:
+7,1,14
+
+nearby tickets:
+7,3,47
+40,4,50
+55,2,20
+38,0,100
+`
@@ -1,143 +1,94 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
-type coord3d struct {
-	X int
-	Y int
-	Z int
-}
-
-func (c coord3d) text() string {
-	return fmt.Sprintf("[x:%d,y:%d,z:%d]", c.X, c.Y, c.Z)
-}
+func main() {
+	show := flag.String("show", "", "print the layers of the pocket dimension after these comma separated cycles, e.g. \"0,1,2\"")
+	dims := flag.Int("dims", 3, "the number of dimensions to print, 3 or 4")
+	flag.Parse()
 
-func add(c1, c2 coord3d) coord3d {
-	return coord3d{
-		X: c1.X + c2.X,
-		Y: c1.Y + c2.Y,
-		Z: c1.Z + c2.Z,
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
 	}
-}
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
 
-func make3dBaseVectors() []coord3d {
-	components := [3]int{-1, 0, 1}
-	var baseVectors []coord3d
-	for _, x := range components {
-		for _, y := range components {
-			for _, z := range components {
-				if x == 0 && y == 0 && z == 0 {
-					continue
-				}
+	var lines []string
+	common.ScanLines(file, func(line string) {
+		lines = append(lines, line)
+	})
 
-				baseVectors = append(baseVectors, coord3d{X: x, Y: y, Z: z})
-			}
-		}
+	if *show == "" {
+		fmt.Printf("Part 1: %d\n", newPocket(lines, 3).run(6).count())
+		fmt.Printf("Part 2: %d\n", newPocket(lines, 4).run(6).count())
+		return
 	}
-	return baseVectors
-}
-
-var vectors3d = make3dBaseVectors()
-
-type space3d map[coord3d]struct{}
-
-// counts up to "limit" number of neighbors in space
-func (s space3d) countNeighbors(coord coord3d, limit int) int {
-	active := 0
-	for _, vec := range vectors3d {
-		neighborPos := add(coord, vec)
-
-		if _, ok := s[neighborPos]; ok {
-			active++
 
-			// stop early if we hit the limit
-			if active >= limit {
-				return active
-			}
-		}
+	cycles, err := parseCycles(*show)
+	common.MustNotError(err)
+	if *dims != 3 && *dims != 4 {
+		log.Fatalf("can't print %d dimensions", *dims)
 	}
 
-	return active
-}
-
-func (s space3d) cycle() space3d {
-	// Make a copy so we can switch all nodes "at once"
-	nextSpace := make(space3d)
-
-	// The only things we need to know about in the space are the active nodes
-	for cube := range s {
-
-		// Check if the active cube remains active
-		if count := s.countNeighbors(cube, 4); count == 2 || count == 3 {
-			nextSpace[cube] = struct{}{}
+	p := newPocket(lines, *dims)
+	done := 0
+	for i, cycle := range cycles {
+		p.run(cycle - done)
+		done = cycle
+		if i > 0 {
+			fmt.Println()
 		}
-
-		// Next, we can check every neighbour of the active cube to see if it is inactive
-		for _, vec := range vectors3d {
-
-			neighbor := add(cube, vec)
-
-			// inactive nodes aren't in the space
-			if _, ok := s[neighbor]; !ok {
-				// inactive neighbors will activate if there are exactly 3 active neighbors
-				if count := s.countNeighbors(neighbor, 4); count == 3 {
-					nextSpace[neighbor] = struct{}{}
-				}
-			}
+		if cycle == 0 {
+			fmt.Print("Before any cycles:\n\n")
+		} else {
+			fmt.Printf("After %d cycle%s:\n\n", cycle, plural(cycle))
 		}
+		p.print(os.Stdout)
 	}
-
-	return nextSpace
 }
 
-func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
 }
 
-func load3dSpace(reader io.Reader) space3d {
-	s := space3d{}
-	y := 0
-	common.ScanLines(reader, func(line string) {
-
-		for x, b := range line {
-			// Only need to store active nodes, assume all other coords inactive
-			if b == '#' {
-				s[coord3d{X: x, Y: y, Z: 0}] = struct{}{}
-			}
+// Parses a comma separated list of cycles, sorting them
+func parseCycles(text string) ([]int, error) {
+	var cycles []int
+	for _, field := range strings.Split(text, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad cycle %q", field)
 		}
-
-		y++
-	})
-
-	return s
+		cycles = append(cycles, n)
+	}
+	sort.Ints(cycles)
+	return cycles, nil
 }
 
 func part1(reader io.Reader) int {
-	space := load3dSpace(reader)
-	for i := 0; i < 6; i++ {
-		space = space.cycle()
-	}
-	// All nodes mapped are active
-	return len(space)
+	return loadPocket(reader, 3).run(6).count()
 }
 
 func part2(reader io.Reader) int {
-	space := load4dSpace(reader)
-	for i := 0; i < 6; i++ {
-		space = space.cycle()
-	}
-	// All nodes mapped are active
-	return len(space)
+	return loadPocket(reader, 4).run(6).count()
 }
 
-// TODO: not sure how best to share a lot of this common code in Go without generics... too tired to bother
-
 type coord4d struct {
 	X int
 	Y int
@@ -178,72 +129,3 @@ func make4dBaseVectors() []coord4d {
 }
 
 var vectors4d = make4dBaseVectors()
-
-type space4d map[coord4d]struct{}
-
-// counts up to "limit" number of neighbors in space
-func (s space4d) countNeighbors(coord coord4d, limit int) int {
-	active := 0
-	for _, vec := range vectors4d {
-		neighborPos := add4d(coord, vec)
-
-		if _, ok := s[neighborPos]; ok {
-			active++
-
-			// stop early if we hit the limit
-			if active >= limit {
-				return active
-			}
-		}
-	}
-
-	return active
-}
-
-func (s space4d) cycle() space4d {
-	// Make a copy so we can switch all nodes "at once"
-	nextSpace := make(space4d)
-
-	// The only things we need to know about in the space are the active nodes
-	for cube := range s {
-
-		// Check if the active cube remains active
-		if count := s.countNeighbors(cube, 4); count == 2 || count == 3 {
-			nextSpace[cube] = struct{}{}
-		}
-
-		// Next, we can check every neighbour of the active cube to see if it is inactive
-		for _, vec := range vectors4d {
-
-			neighbor := add4d(cube, vec)
-
-			// inactive nodes aren't in the space
-			if _, ok := s[neighbor]; !ok {
-				// inactive neighbors will activate if there are exactly 3 active neighbors
-				if count := s.countNeighbors(neighbor, 4); count == 3 {
-					nextSpace[neighbor] = struct{}{}
-				}
-			}
-		}
-	}
-
-	return nextSpace
-}
-
-func load4dSpace(reader io.Reader) space4d {
-	s := space4d{}
-	y := 0
-	common.ScanLines(reader, func(line string) {
-
-		for x, b := range line {
-			// Only need to store active nodes, assume all other coords inactive
-			if b == '#' {
-				s[coord4d{X: x, Y: y, Z: 0}] = struct{}{}
-			}
-		}
-
-		y++
-	})
-
-	return s
-}
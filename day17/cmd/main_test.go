@@ -2,10 +2,14 @@ package main
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
 	"testing"
+
+	common "github.com/torbensky/adventofcode-common"
 )
 
 const part1Answer = 112
@@ -113,3 +117,250 @@ func openTestInput(t *testing.T) *os.File {
 
 	return file
 }
+
+func TestMirrorSymmetry(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{exampleData, "##.\n#.#\n.##", "#"} {
+		space3 := load3dSpace(strings.NewReader(input))
+		space4 := load4dSpace(strings.NewReader(input))
+		p3 := loadPocket(strings.NewReader(input), 3)
+		p4 := loadPocket(strings.NewReader(input), 4)
+
+		for i := 1; i <= 4; i++ {
+			space3, space4 = space3.cycle(), space4.cycle()
+			p3.cycle()
+			p4.cycle()
+
+			if got := p3.count(); got != len(space3) {
+				t.Errorf("%q cycle %d: 3 dimensions want %d got %d\n", input, i, len(space3), got)
+			}
+			if got := p4.count(); got != len(space4) {
+				t.Errorf("%q cycle %d: 4 dimensions want %d got %d\n", input, i, len(space4), got)
+			}
+			for cube := range space4 {
+				if !p4.isActive(cube) {
+					t.Fatalf("%q cycle %d: %s should be active\n", input, i, cube.text())
+				}
+			}
+		}
+	}
+}
+
+func TestPocketCounts(t *testing.T) {
+	t.Parallel()
+	if got := loadPocket(strings.NewReader(exampleData), 3).run(6).count(); got != part1Answer {
+		t.Errorf("3 dimensions: want %d got %d\n", part1Answer, got)
+	}
+	if got := loadPocket(strings.NewReader(exampleData), 4).run(6).count(); got != part2Answer {
+		t.Errorf("4 dimensions: want %d got %d\n", part2Answer, got)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	t.Parallel()
+	var sb strings.Builder
+	loadPocket(strings.NewReader(exampleData), 3).run(1).print(&sb)
+
+	// the first cycle of the example, which the puzzle shows cropped a little differently
+	want := `z=-1
+#..
+..#
+.#.
+
+z=0
+#.#
+.##
+.#.
+
+z=1
+#..
+..#
+.#.
+`
+	if got := sb.String(); got != want {
+		t.Errorf("want\n%s\ngot\n%s\n", want, got)
+	}
+
+	sb.Reset()
+	loadPocket(strings.NewReader(exampleData), 4).print(&sb)
+	if want := "z=0, w=0\n.#.\n..#\n###\n"; sb.String() != want {
+		t.Errorf("want\n%s\ngot\n%s\n", want, sb.String())
+	}
+}
+
+// The original simulation of every cube, kept as a reference for the pocket
+
+type coord3d struct {
+	X int
+	Y int
+	Z int
+}
+
+func (c coord3d) text() string {
+	return fmt.Sprintf("[x:%d,y:%d,z:%d]", c.X, c.Y, c.Z)
+}
+
+func add(c1, c2 coord3d) coord3d {
+	return coord3d{
+		X: c1.X + c2.X,
+		Y: c1.Y + c2.Y,
+		Z: c1.Z + c2.Z,
+	}
+}
+
+func make3dBaseVectors() []coord3d {
+	components := [3]int{-1, 0, 1}
+	var baseVectors []coord3d
+	for _, x := range components {
+		for _, y := range components {
+			for _, z := range components {
+				if x == 0 && y == 0 && z == 0 {
+					continue
+				}
+
+				baseVectors = append(baseVectors, coord3d{X: x, Y: y, Z: z})
+			}
+		}
+	}
+	return baseVectors
+}
+
+var vectors3d = make3dBaseVectors()
+
+type space3d map[coord3d]struct{}
+
+// counts up to "limit" number of neighbors in space
+func (s space3d) countNeighbors(coord coord3d, limit int) int {
+	active := 0
+	for _, vec := range vectors3d {
+		neighborPos := add(coord, vec)
+
+		if _, ok := s[neighborPos]; ok {
+			active++
+
+			// stop early if we hit the limit
+			if active >= limit {
+				return active
+			}
+		}
+	}
+
+	return active
+}
+
+func (s space3d) cycle() space3d {
+	// Make a copy so we can switch all nodes "at once"
+	nextSpace := make(space3d)
+
+	// The only things we need to know about in the space are the active nodes
+	for cube := range s {
+
+		// Check if the active cube remains active
+		if count := s.countNeighbors(cube, 4); count == 2 || count == 3 {
+			nextSpace[cube] = struct{}{}
+		}
+
+		// Next, we can check every neighbour of the active cube to see if it is inactive
+		for _, vec := range vectors3d {
+
+			neighbor := add(cube, vec)
+
+			// inactive nodes aren't in the space
+			if _, ok := s[neighbor]; !ok {
+				// inactive neighbors will activate if there are exactly 3 active neighbors
+				if count := s.countNeighbors(neighbor, 4); count == 3 {
+					nextSpace[neighbor] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return nextSpace
+}
+
+func load3dSpace(reader io.Reader) space3d {
+	s := space3d{}
+	y := 0
+	common.ScanLines(reader, func(line string) {
+
+		for x, b := range line {
+			// Only need to store active nodes, assume all other coords inactive
+			if b == '#' {
+				s[coord3d{X: x, Y: y, Z: 0}] = struct{}{}
+			}
+		}
+
+		y++
+	})
+
+	return s
+}
+
+type space4d map[coord4d]struct{}
+
+// counts up to "limit" number of neighbors in space
+func (s space4d) countNeighbors(coord coord4d, limit int) int {
+	active := 0
+	for _, vec := range vectors4d {
+		neighborPos := add4d(coord, vec)
+
+		if _, ok := s[neighborPos]; ok {
+			active++
+
+			// stop early if we hit the limit
+			if active >= limit {
+				return active
+			}
+		}
+	}
+
+	return active
+}
+
+func (s space4d) cycle() space4d {
+	// Make a copy so we can switch all nodes "at once"
+	nextSpace := make(space4d)
+
+	// The only things we need to know about in the space are the active nodes
+	for cube := range s {
+
+		// Check if the active cube remains active
+		if count := s.countNeighbors(cube, 4); count == 2 || count == 3 {
+			nextSpace[cube] = struct{}{}
+		}
+
+		// Next, we can check every neighbour of the active cube to see if it is inactive
+		for _, vec := range vectors4d {
+
+			neighbor := add4d(cube, vec)
+
+			// inactive nodes aren't in the space
+			if _, ok := s[neighbor]; !ok {
+				// inactive neighbors will activate if there are exactly 3 active neighbors
+				if count := s.countNeighbors(neighbor, 4); count == 3 {
+					nextSpace[neighbor] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return nextSpace
+}
+
+func load4dSpace(reader io.Reader) space4d {
+	s := space4d{}
+	y := 0
+	common.ScanLines(reader, func(line string) {
+
+		for x, b := range line {
+			// Only need to store active nodes, assume all other coords inactive
+			if b == '#' {
+				s[coord4d{X: x, Y: y, Z: 0}] = struct{}{}
+			}
+		}
+
+		y++
+	})
+
+	return s
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	common "github.com/torbensky/adventofcode-common"
+)
+
+// A pocket dimension with 3 or 4 dimensions, where W is always 0 in 3 dimensions
+//
+// The initial slice sits at z=0 (and w=0), and the rules treat z and -z alike, so the layer at -z is always a mirror
+// image of the layer at z. Only the layers with z >= 0 (and w >= 0) are simulated, the rest are implied.
+type pocket struct {
+	dims    int
+	active  map[coord4d]struct{}
+	vectors []coord4d
+}
+
+func newPocket(lines []string, dims int) *pocket {
+	p := &pocket{dims: dims, active: make(map[coord4d]struct{})}
+	for _, vec := range vectors4d {
+		if dims == 4 || vec.W == 0 {
+			p.vectors = append(p.vectors, vec)
+		}
+	}
+
+	for y, line := range lines {
+		for x, b := range line {
+			if b == '#' {
+				p.active[coord4d{X: x, Y: y}] = struct{}{}
+			}
+		}
+	}
+	return p
+}
+
+func loadPocket(reader io.Reader, dims int) *pocket {
+	var lines []string
+	common.ScanLines(reader, func(line string) {
+		lines = append(lines, line)
+	})
+	return newPocket(lines, dims)
+}
+
+// How many times a cube at from counts as a neighbour of the cube at to
+//
+// A cube at z=1 has a mirror image at z=-1, which is also next to every cube at z=0.
+func (p *pocket) weight(from, to coord4d) int {
+	weight := 1
+	if from.Z == 1 && to.Z == 0 {
+		weight *= 2
+	}
+	if from.W == 1 && to.W == 0 {
+		weight *= 2
+	}
+	return weight
+}
+
+// Runs a single cycle
+func (p *pocket) cycle() {
+	// Count the active neighbours of every cube next to an active cube, in a single pass over the active cubes
+	counts := make(map[coord4d]int)
+	for cube := range p.active {
+		for _, vec := range p.vectors {
+			neighbor := add4d(cube, vec)
+			if neighbor.Z < 0 || neighbor.W < 0 {
+				// a mirror image, counted through its twin
+				continue
+			}
+			counts[neighbor] += p.weight(cube, neighbor)
+		}
+	}
+
+	next := make(map[coord4d]struct{})
+	for cube, count := range counts {
+		if _, active := p.active[cube]; count == 3 || (active && count == 2) {
+			next[cube] = struct{}{}
+		}
+	}
+	p.active = next
+}
+
+// Runs the given number of cycles
+func (p *pocket) run(cycles int) *pocket {
+	for i := 0; i < cycles; i++ {
+		p.cycle()
+	}
+	return p
+}
+
+// Counts the active cubes, including the mirror images
+func (p *pocket) count() int {
+	total := 0
+	for cube := range p.active {
+		images := 1
+		if cube.Z != 0 {
+			images *= 2
+		}
+		if cube.W != 0 {
+			images *= 2
+		}
+		total += images
+	}
+	return total
+}
+
+func (p *pocket) isActive(c coord4d) bool {
+	if c.Z < 0 {
+		c.Z = -c.Z
+	}
+	if c.W < 0 {
+		c.W = -c.W
+	}
+	_, ok := p.active[c]
+	return ok
+}
+
+// Prints every layer the way the puzzle does, cropped to the active cubes
+func (p *pocket) print(w io.Writer) {
+	if len(p.active) == 0 {
+		fmt.Fprintln(w, "(no active cubes)")
+		return
+	}
+
+	var lo, hi coord4d
+	first := true
+	for cube := range p.active {
+		if first {
+			lo, hi = cube, cube
+			first = false
+		}
+		lo.X, hi.X = minInt(lo.X, cube.X), maxInt(hi.X, cube.X)
+		lo.Y, hi.Y = minInt(lo.Y, cube.Y), maxInt(hi.Y, cube.Y)
+		hi.Z, hi.W = maxInt(hi.Z, cube.Z), maxInt(hi.W, cube.W)
+	}
+
+	var layers []string
+	for lw := -hi.W; lw <= hi.W; lw++ {
+		for z := -hi.Z; z <= hi.Z; z++ {
+			var sb strings.Builder
+			if p.dims == 4 {
+				fmt.Fprintf(&sb, "z=%d, w=%d\n", z, lw)
+			} else {
+				fmt.Fprintf(&sb, "z=%d\n", z)
+			}
+			for y := lo.Y; y <= hi.Y; y++ {
+				for x := lo.X; x <= hi.X; x++ {
+					if p.isActive(coord4d{X: x, Y: y, Z: z, W: lw}) {
+						sb.WriteByte('#')
+					} else {
+						sb.WriteByte('.')
+					}
+				}
+				sb.WriteByte('\n')
+			}
+			layers = append(layers, sb.String())
+		}
+	}
+	fmt.Fprint(w, strings.Join(layers, "\n"))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
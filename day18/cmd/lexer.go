@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+type tokenKind int
+
+const (
+	add tokenKind = iota
+	prod
+	openParen
+	closeParen
+	number
+	sub
+	div
+)
+
+type token struct {
+	kind tokenKind
+	val  *big.Int // numbers can be any size
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case number:
+		return t.MustValue().String()
+	case add:
+		return "+"
+	case sub:
+		return "-"
+	case prod:
+		return "*"
+	case div:
+		return "/"
+	case openParen:
+		return "("
+	case closeParen:
+		return ")"
+	default:
+		return fmt.Sprintf("kind:%d", t.kind)
+	}
+}
+
+func (t token) Kind() tokenKind {
+	return t.kind
+}
+
+func (t token) Pos() int {
+	return t.pos
+}
+
+func (t token) Value() (*big.Int, error) {
+	switch t.kind {
+	case number:
+		return t.val, nil
+	default:
+		return nil, fmt.Errorf("cannot get value on %s", t)
+	}
+}
+
+func (t token) MustValue() *big.Int {
+	val, err := t.Value()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return val
+}
+
+type Token interface {
+	Kind() tokenKind
+	Pos() int // the position of the token in the line, from 0
+	Value() (*big.Int, error)
+	MustValue() *big.Int
+	String() string
+}
+
+// An error in an expression, at a position in the line
+type exprError struct {
+	pos int
+	msg string
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.msg, e.pos+1)
+}
+
+func isNum(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+type lexer struct {
+	pos  int
+	line string
+}
+
+func newLexer(line string) Lexer {
+	return &lexer{pos: 0, line: line}
+}
+
+var endOfTokensError = fmt.Errorf("no more tokens")
+
+func (l *lexer) ReadAll() ([]Token, error) {
+	var all []Token
+	for {
+		current, err := l.NextToken()
+		if err != nil {
+			if err != endOfTokensError {
+				return nil, err
+			}
+			break
+		}
+		all = append(all, current)
+	}
+
+	return all, nil
+}
+
+func (l *lexer) NextToken() (Token, error) {
+	// End of expression
+	if l.pos >= len(l.line) {
+		return nil, endOfTokensError
+	}
+
+	start := l.pos
+	switch c := l.line[l.pos]; c {
+	case '+':
+		l.pos++
+		return token{kind: add, pos: start}, nil
+	case '-':
+		l.pos++
+		return token{kind: sub, pos: start}, nil
+	case '*':
+		l.pos++
+		return token{kind: prod, pos: start}, nil
+	case '/':
+		l.pos++
+		return token{kind: div, pos: start}, nil
+	case '(':
+		l.pos++
+		return token{kind: openParen, pos: start}, nil
+	case ')':
+		l.pos++
+		return token{kind: closeParen, pos: start}, nil
+	case ' ':
+		l.pos++
+		return l.NextToken()
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		// number
+		// read full digit
+		numEnd := l.pos + 1
+		for ; numEnd < len(l.line); numEnd++ {
+			if !isNum(l.line[numEnd]) {
+				break
+			}
+		}
+		val, _ := new(big.Int).SetString(l.line[l.pos:numEnd], 10)
+		l.pos = numEnd
+		return token{kind: number, val: val, pos: start}, nil
+	default:
+		return nil, &exprError{pos: l.pos, msg: fmt.Sprintf("unrecognized character type %q", c)}
+	}
+}
+
+type Lexer interface {
+	NextToken() (Token, error)
+	ReadAll() ([]Token, error)
+}
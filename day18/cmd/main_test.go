@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"math/big"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -24,19 +26,110 @@ func TestEvaluateExpression(t *testing.T) {
 	} {
 		fmt.Printf("expression '%s'\n", c.expr)
 		got := evaluateExpr(c.expr)
-		if c.result != got {
+		if got.Cmp(big.NewInt(int64(c.result))) != 0 {
 			t.Fatalf("%s wanted %d got %d", c.expr, c.result, got)
 		}
 	}
 
 }
 
+func TestEvaluate2(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct {
+		expr   string
+		result int
+	}{
+		{"1 + (2 * 3) + (4 * (5 + 6))", 51},
+		{"2 * 3 + (4 * 5)", 46},
+		{"5 + (8 * 3 + 9 + 3 * 4 * 3)", 1445},
+		{"5 * 9 * (7 * 3 * 3 + 9 * 3 + (8 + 6 * 4))", 669060},
+		{"((2 + 4 * 9) * (6 + 9 * 8 + 6) + 6) + 2 + 4 * 2", 23340},
+	} {
+		if got := evaluate2(c.expr); got.Cmp(big.NewInt(int64(c.result))) != 0 {
+			t.Errorf("%s wanted %d got %d", c.expr, c.result, got)
+		}
+	}
+}
+
+func TestPrecedenceTables(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct {
+		expr        string
+		table       precedenceTable
+		parenthesis string
+		result      int
+	}{
+		{"1 + 2 * 3", equalPrecedence, "((1 + 2) * 3)", 9},
+		{"1 + 2 * 3", additionFirst, "((1 + 2) * 3)", 9},
+		{"1 + 2 * 3", conventional, "(1 + (2 * 3))", 7},
+		{"2 * 3 + 4", additionFirst, "(2 * (3 + 4))", 14},
+		{"2 * 3 + 4", conventional, "((2 * 3) + 4)", 10},
+		{"10 - 4 - 3", conventional, "((10 - 4) - 3)", 3},
+		{"100 / 10 / 5", conventional, "((100 / 10) / 5)", 2},
+		{"7 / 2", conventional, "(7 / 2)", 3},
+		{"-3 * -(2 + 1)", conventional, "((-3) * (-(2 + 1)))", 9},
+		{"- -4 - 1", equalPrecedence, "((-(-4)) - 1)", 3},
+		{"2 * 3 - 1 * 4", additionFirst, "((2 * (3 - 1)) * 4)", 16},
+		{"8 - 2 + 1", additionFirst, "((8 - 2) + 1)", 7},
+	} {
+		tree, err := parse(c.expr, c.table)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.expr, err)
+			continue
+		}
+		if got := tree.String(); got != c.parenthesis {
+			t.Errorf("%s parsed as %s wanted %s", c.expr, got, c.parenthesis)
+		}
+		if got, err := tree.eval(promote); err != nil || got.Int().Cmp(big.NewInt(int64(c.result))) != 0 {
+			t.Errorf("%s wanted %d got %d (%v)", c.expr, c.result, got, err)
+		}
+	}
+}
+
+func TestRightAssociative(t *testing.T) {
+	t.Parallel()
+	table := precedenceTable{sub: {precedence: 1, assoc: rightAssoc}}
+	tree, err := parse("10 - 4 - 3", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.String(); got != "(10 - (4 - 3))" {
+		t.Errorf("wanted %s got %s", "(10 - (4 - 3))", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct {
+		expr        string
+		err         string
+		parenthesis string
+	}{
+		{"1 +", "expected a number or \"(\" but the expression ended at column 4", "(1 + ?)"},
+		{"(1 + 2", "unclosed \"(\" at column 1", "(1 + 2)"},
+		{"1 + 2)", "unexpected \")\" at column 6", "(1 + 2)"},
+		{"1 + * 2", "expected a number or \"(\" but found \"*\" at column 5", "(1 + (? * 2))"},
+		{"1 + a", "unrecognized character type 'a' at column 5", "?"},
+		{"4 / (2 - 2)", "division by zero at column 3", ""},
+	} {
+		tree, err := parse(c.expr, conventional)
+		if err == nil {
+			_, err = tree.eval(promote)
+		} else if got := tree.String(); got != c.parenthesis {
+			t.Errorf("%s parsed as %s wanted %s", c.expr, got, c.parenthesis)
+		}
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%s wanted error %q got %v", c.expr, c.err, err)
+		}
+	}
+}
+
 func TestPart2(t *testing.T) {
 	t.Parallel()
 	reader := bufio.NewReader(openTestInput(t))
 	got := part2(reader)
-	want := 231235959382961
-	if want != got {
+	want := big.NewInt(231235959382961)
+	if want.Cmp(got) != 0 {
 		t.Errorf("expected %d got %d\n", want, got)
 	}
 }
@@ -45,8 +138,8 @@ func TestPart1(t *testing.T) {
 	t.Parallel()
 	reader := bufio.NewReader(openTestInput(t))
 	got := part1(reader)
-	want := 8929569623593
-	if want != got {
+	want := big.NewInt(8929569623593)
+	if want.Cmp(got) != 0 {
 		t.Errorf("expected %d got %d\n", want, got)
 	}
 }
@@ -59,3 +152,99 @@ func openTestInput(t *testing.T) *os.File {
 
 	return file
 }
+
+func TestREPL(t *testing.T) {
+	t.Parallel()
+	var sb strings.Builder
+	r, err := newREPL(&sb, "addition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.run(strings.NewReader("2 * 3 + 4\n:mode conventional\n2 * 3 + 4\n1 + $\n:mode bogus\n:quit\n1 + 1\n"))
+
+	want := `(addition) tokens: 2@1 *@3 3@5 +@7 4@9
+parsed: (2 * (3 + 4))
+tree:
+  *
+    2
+    +
+      3
+      4
+result: 14
+(addition) (conventional) tokens: 2@1 *@3 3@5 +@7 4@9
+parsed: ((2 * 3) + 4)
+tree:
+  +
+    *
+      2
+      3
+    4
+result: 10
+(conventional) tokens: 1@1 +@3
+parsed: ?
+tree:
+  error: unrecognized character type '$'
+  1 + $
+      ^ unrecognized character type '$' at column 5
+(conventional) error: unknown precedence mode "bogus"
+(conventional) `
+	if got := sb.String(); got != want {
+		t.Errorf("wanted\n%s\ngot\n%s\n", want, got)
+	}
+
+	if _, err := newREPL(&sb, "bogus"); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct {
+		expr   string
+		table  precedenceTable
+		result string
+	}{
+		// 2^64, past what an int64 holds
+		{"4294967296 * 4294967296", equalPrecedence, "18446744073709551616"},
+		{"9223372036854775807 + 1", equalPrecedence, "9223372036854775808"},
+		{"-9223372036854775807 - 2", conventional, "-9223372036854775809"},
+		{"-(-9223372036854775807 - 1)", conventional, "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", conventional, "9223372036854775808"},
+		{"(-9223372036854775807 - 1) * -1", conventional, "9223372036854775808"},
+		// literals can be any size, and shrink back when divided
+		{"123456789012345678901234567890 / 1000000000000000000000", conventional, "123456789"},
+		{"9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 * 9 + 1", additionFirst, "13508517176729920890"},
+		{"(9 * 9 + 9) * (99 * 99 * 99 + 9) * (999999 * 999999 + 9) * (99999 * 99999)", equalPrecedence, "873257988032591230689993277200"},
+	} {
+		for _, arith := range []arithmetic{promote, bigOnly} {
+			got, err := evaluate(c.expr, c.table, arith)
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.expr, err)
+				continue
+			}
+			if got.String() != c.result {
+				t.Errorf("%s (arithmetic %d) wanted %s got %s", c.expr, arith, c.result, got)
+			}
+		}
+	}
+}
+
+func TestExactSum(t *testing.T) {
+	t.Parallel()
+	// each line is more than 2^62, so the sum is past 2^63
+	homework := "4611686018427387904 + 1\n2 * 2305843009213693952 + 5\n1 + 1\n"
+	for _, c := range []struct {
+		table precedenceTable
+		arith arithmetic
+		sum   string
+	}{
+		{equalPrecedence, promote, "9223372036854775816"},
+		{equalPrecedence, bigOnly, "9223372036854775816"},
+		{additionFirst, promote, "9223372036854775821"},
+		{additionFirst, bigOnly, "9223372036854775821"},
+	} {
+		if got := sumLines(strings.NewReader(homework), c.table, c.arith).String(); got != c.sum {
+			t.Errorf("wanted %s got %s", c.sum, got)
+		}
+	}
+}
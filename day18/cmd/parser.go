@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+)
+
+type associativity int
+
+const (
+	leftAssoc associativity = iota
+	rightAssoc
+)
+
+// How tightly a binary operator binds, higher precedence binds tighter
+type operatorRule struct {
+	precedence int
+	assoc      associativity
+}
+
+// The binary operators and how they bind, unary minus always binds tighter than any of them
+type precedenceTable map[tokenKind]operatorRule
+
+var (
+	// The homework's first rules: everything is evaluated left to right
+	equalPrecedence = precedenceTable{
+		add:  {precedence: 1},
+		sub:  {precedence: 1},
+		prod: {precedence: 1},
+		div:  {precedence: 1},
+	}
+
+	// The homework's advanced rules: addition (and subtraction) before multiplication (and division)
+	additionFirst = precedenceTable{
+		add:  {precedence: 2},
+		sub:  {precedence: 2},
+		prod: {precedence: 1},
+		div:  {precedence: 1},
+	}
+
+	// The usual rules of arithmetic
+	conventional = precedenceTable{
+		add:  {precedence: 1},
+		sub:  {precedence: 1},
+		prod: {precedence: 2},
+		div:  {precedence: 2},
+	}
+)
+
+// A node of an expression's syntax tree
+type node interface {
+	eval(arith arithmetic) (value, error)
+	String() string // the expression with every operation in parentheses
+}
+
+type numberNode struct {
+	tkn Token
+}
+
+func (n numberNode) eval(arith arithmetic) (value, error) {
+	v, err := n.tkn.Value()
+	if err != nil {
+		return value{}, err
+	}
+	return newValue(v, arith), nil
+}
+
+func (n numberNode) String() string {
+	return n.tkn.String()
+}
+
+// Unary minus
+type negateNode struct {
+	op      Token
+	operand node
+}
+
+func (n negateNode) eval(arith arithmetic) (value, error) {
+	v, err := n.operand.eval(arith)
+	if err != nil {
+		return value{}, err
+	}
+	return negValue(v), nil
+}
+
+func (n negateNode) String() string {
+	return fmt.Sprintf("(-%s)", n.operand)
+}
+
+type binaryNode struct {
+	op          Token
+	left, right node
+}
+
+func (n binaryNode) eval(arith arithmetic) (value, error) {
+	a, err := n.left.eval(arith)
+	if err != nil {
+		return value{}, err
+	}
+	b, err := n.right.eval(arith)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch n.op.Kind() {
+	case add:
+		return addValues(a, b), nil
+	case sub:
+		return subValues(a, b), nil
+	case prod:
+		return mulValues(a, b), nil
+	case div:
+		if b.isZero() {
+			return value{}, &exprError{pos: n.op.Pos(), msg: "division by zero"}
+		}
+		return divValues(a, b), nil
+	}
+	return value{}, &exprError{pos: n.op.Pos(), msg: fmt.Sprintf("unknown operator %s", n.op)}
+}
+
+func (n binaryNode) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.left, n.op, n.right)
+}
+
+// A part of the expression that couldn't be parsed
+type errorNode struct {
+	err *exprError
+}
+
+func (n errorNode) eval(arith arithmetic) (value, error) {
+	return value{}, n.err
+}
+
+func (n errorNode) String() string {
+	return "?"
+}
+
+// A Pratt parser, where the precedence table decides how operators bind
+//
+// The parser carries on after a syntax error, putting an error node in the tree where the problem was.
+type parser struct {
+	tokens []Token
+	next   int
+	table  precedenceTable
+	end    int // the position just past the end of the line
+	errors []*exprError
+}
+
+// Parses an expression, returning the first syntax error along with the tree
+func parse(line string, table precedenceTable) (node, error) {
+	tokens, err := newLexer(line).ReadAll()
+	if err != nil {
+		if e, ok := err.(*exprError); ok {
+			return errorNode{err: e}, e
+		}
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, table: table, end: len(line)}
+	tree := p.expression(0)
+	if tkn, ok := p.peek(); ok {
+		p.fail(tkn.Pos(), fmt.Sprintf("unexpected %q", tkn))
+	}
+
+	if len(p.errors) > 0 {
+		return tree, p.errors[0]
+	}
+	return tree, nil
+}
+
+func (p *parser) peek() (Token, bool) {
+	if p.next >= len(p.tokens) {
+		return nil, false
+	}
+	return p.tokens[p.next], true
+}
+
+func (p *parser) fail(pos int, msg string) node {
+	err := &exprError{pos: pos, msg: msg}
+	p.errors = append(p.errors, err)
+	return errorNode{err: err}
+}
+
+// Parses operations that bind at least as tightly as minPrecedence
+func (p *parser) expression(minPrecedence int) node {
+	left := p.operand()
+	for {
+		tkn, ok := p.peek()
+		if !ok {
+			return left
+		}
+		rule, isOperator := p.table[tkn.Kind()]
+		if !isOperator || rule.precedence < minPrecedence {
+			return left
+		}
+		p.next++
+
+		// a left associative operator's right side can't contain operators that bind the same
+		nextPrecedence := rule.precedence + 1
+		if rule.assoc == rightAssoc {
+			nextPrecedence = rule.precedence
+		}
+		left = binaryNode{op: tkn, left: left, right: p.expression(nextPrecedence)}
+	}
+}
+
+// Parses a number, a negated operand or an expression in parentheses
+func (p *parser) operand() node {
+	tkn, ok := p.peek()
+	if !ok {
+		return p.fail(p.end, "expected a number or \"(\" but the expression ended")
+	}
+
+	switch tkn.Kind() {
+	case number:
+		p.next++
+		return numberNode{tkn: tkn}
+	case sub:
+		p.next++
+		return negateNode{op: tkn, operand: p.operand()}
+	case openParen:
+		p.next++
+		inner := p.expression(0)
+		if closing, ok := p.peek(); ok && closing.Kind() == closeParen {
+			p.next++
+		} else {
+			p.fail(tkn.Pos(), "unclosed \"(\"")
+		}
+		return inner
+	}
+
+	return p.fail(tkn.Pos(), fmt.Sprintf("expected a number or \"(\" but found %q", tkn))
+}
+
+// Parses and evaluates an expression
+func evaluate(line string, table precedenceTable, arith arithmetic) (value, error) {
+	tree, err := parse(line, table)
+	if err != nil {
+		return value{}, err
+	}
+	return tree.eval(arith)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The precedence tables that can be picked in the REPL
+var tables = map[string]precedenceTable{
+	"equal":        equalPrecedence,
+	"addition":     additionFirst,
+	"conventional": conventional,
+}
+
+const replHelp = `type an expression to see how it is parsed and evaluated, or a command:
+  :mode [name]  show or change the precedence mode (equal, addition or conventional)
+  :big [on|off] show or change whether big integers are used throughout
+  :help         print this message
+  :quit         leave the REPL
+`
+
+// An interactive REPL showing how expressions are parsed under the homework's rules
+type repl struct {
+	out   io.Writer
+	mode  string
+	arith arithmetic
+}
+
+func newREPL(out io.Writer, mode string) (*repl, error) {
+	if _, ok := tables[mode]; !ok {
+		return nil, fmt.Errorf("unknown precedence mode %q (try %s)", mode, strings.Join(modeNames(), ", "))
+	}
+	return &repl{out: out, mode: mode}, nil
+}
+
+func modeNames() []string {
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reads lines from the reader until it is exhausted or the quit command is given
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintf(r.out, "(%s) ", r.mode)
+	for scanner.Scan() {
+		if quit := r.exec(scanner.Text()); quit {
+			return
+		}
+		fmt.Fprintf(r.out, "(%s) ", r.mode)
+	}
+	fmt.Fprintln(r.out)
+}
+
+// Handles a single line, returning true when the REPL should quit
+func (r *repl) exec(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	if !strings.HasPrefix(fields[0], ":") {
+		r.show(line)
+		return false
+	}
+
+	switch fields[0] {
+	case ":mode":
+		if len(fields) == 1 {
+			fmt.Fprintf(r.out, "mode: %s (modes: %s)\n", r.mode, strings.Join(modeNames(), ", "))
+			break
+		}
+		if _, ok := tables[fields[1]]; !ok {
+			fmt.Fprintf(r.out, "error: unknown precedence mode %q\n", fields[1])
+			break
+		}
+		r.mode = fields[1]
+	case ":big":
+		switch {
+		case len(fields) == 1:
+			fmt.Fprintf(r.out, "big: %t\n", r.arith == bigOnly)
+		case fields[1] == "on":
+			r.arith = bigOnly
+		case fields[1] == "off":
+			r.arith = promote
+		default:
+			fmt.Fprintln(r.out, "error: usage :big [on|off]")
+		}
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+	case ":quit", ":q":
+		return true
+	default:
+		fmt.Fprintf(r.out, "error: unknown command %q (try :help)\n", fields[0])
+	}
+	return false
+}
+
+// Prints the tokens, parse tree and result of an expression
+func (r *repl) show(line string) {
+	// the tokens the lexer manages to read, up to any error
+	var tokens []string
+	lex := newLexer(line)
+	for {
+		tkn, err := lex.NextToken()
+		if err != nil {
+			break
+		}
+		tokens = append(tokens, fmt.Sprintf("%s@%d", tkn, tkn.Pos()+1))
+	}
+	fmt.Fprintf(r.out, "tokens: %s\n", strings.Join(tokens, " "))
+
+	tree, err := parse(line, tables[r.mode])
+	if tree != nil {
+		fmt.Fprintf(r.out, "parsed: %s\n", tree)
+		fmt.Fprintln(r.out, "tree:")
+		writeTree(r.out, tree, 1)
+	}
+	if err == nil {
+		var result value
+		if result, err = tree.eval(r.arith); err == nil {
+			fmt.Fprintf(r.out, "result: %s\n", result)
+			return
+		}
+	}
+	r.showError(line, err)
+}
+
+// Points at the column the error is in
+func (r *repl) showError(line string, err error) {
+	e, ok := err.(*exprError)
+	if !ok {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(r.out, "  %s\n  %s^ %v\n", line, strings.Repeat(" ", e.pos), e)
+}
+
+// Prints the tree with an operator on each line above its indented operands
+func writeTree(w io.Writer, n node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch n := n.(type) {
+	case binaryNode:
+		fmt.Fprintf(w, "%s%s\n", indent, n.op)
+		writeTree(w, n.left, depth+1)
+		writeTree(w, n.right, depth+1)
+	case negateNode:
+		fmt.Fprintf(w, "%s-\n", indent)
+		writeTree(w, n.operand, depth+1)
+	case errorNode:
+		fmt.Fprintf(w, "%serror: %s\n", indent, n.err.msg)
+	default:
+		fmt.Fprintf(w, "%s%s\n", indent, n)
+	}
+}
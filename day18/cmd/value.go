@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// How expressions are evaluated
+type arithmetic int
+
+const (
+	promote arithmetic = iota // int64 until an operation overflows, then big.Int
+	bigOnly                   // big.Int for every value
+)
+
+// The result of evaluating an expression
+//
+// Values stay in small until an operation overflows, when they are promoted to big. Big values are never modified.
+type value struct {
+	small int64
+	big   *big.Int
+}
+
+// Converts a number, keeping it small when it fits and the arithmetic allows it
+func newValue(n *big.Int, arith arithmetic) value {
+	if arith == promote && n.IsInt64() {
+		return value{small: n.Int64()}
+	}
+	return value{big: n}
+}
+
+func (v value) isBig() bool {
+	return v.big != nil
+}
+
+func (v value) Int() *big.Int {
+	if v.big != nil {
+		return v.big
+	}
+	return big.NewInt(v.small)
+}
+
+func (v value) String() string {
+	return v.Int().String()
+}
+
+func (v value) isZero() bool {
+	if v.big != nil {
+		return v.big.Sign() == 0
+	}
+	return v.small == 0
+}
+
+func addValues(a, b value) value {
+	if !a.isBig() && !b.isBig() {
+		s := a.small + b.small
+		if !(a.small > 0 && b.small > 0 && s < 0) && !(a.small < 0 && b.small < 0 && s >= 0) {
+			return value{small: s}
+		}
+	}
+	return value{big: new(big.Int).Add(a.Int(), b.Int())}
+}
+
+func subValues(a, b value) value {
+	if !a.isBig() && !b.isBig() {
+		d := a.small - b.small
+		if !(a.small >= 0 && b.small < 0 && d < 0) && !(a.small < 0 && b.small > 0 && d >= 0) {
+			return value{small: d}
+		}
+	}
+	return value{big: new(big.Int).Sub(a.Int(), b.Int())}
+}
+
+func mulValues(a, b value) value {
+	if !a.isBig() && !b.isBig() {
+		if a.small == 0 || b.small == 0 {
+			return value{}
+		}
+		p := a.small * b.small
+		minusOneByMin := (a.small == -1 && b.small == math.MinInt64) || (b.small == -1 && a.small == math.MinInt64)
+		if !minusOneByMin && p/b.small == a.small {
+			return value{small: p}
+		}
+	}
+	return value{big: new(big.Int).Mul(a.Int(), b.Int())}
+}
+
+// Divides, truncating towards zero, b must not be zero
+func divValues(a, b value) value {
+	if !a.isBig() && !b.isBig() && !(a.small == math.MinInt64 && b.small == -1) {
+		return value{small: a.small / b.small}
+	}
+	return value{big: new(big.Int).Quo(a.Int(), b.Int())}
+}
+
+func negValue(a value) value {
+	if !a.isBig() && a.small != math.MinInt64 {
+		return value{small: -a.small}
+	}
+	return value{big: new(big.Int).Neg(a.Int())}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Compiles rules into a single anchored regular expression
+//
+// Rules that don't refer to themselves are regular, and become a group of alternatives. Two self referencing
+// shapes are also supported, where X and Y are sequences that don't refer back to the rule:
+//
+//	n: X | X n      becomes (?:X)+, which is exact (as does n: X | n X)
+//	n: X Y | X n Y  becomes X{1}Y{1}|X{2}Y{2}|... up to a limit, as a regular expression can't count
+type regexCompiler struct {
+	rules     map[int]rule
+	limit     int // the most repeats of a balanced X n Y rule, 0 to choose one from maxLength
+	maxLength int // the longest line that will be matched, used to choose a limit
+	minLen    map[int]int
+	done      map[int]string
+	visiting  map[int]bool
+	cutoff    int // the fewest repeats a balanced rule was cut off at, 0 while nothing has been
+}
+
+func newRegexCompiler(rules map[int]rule, limit, maxLength int) *regexCompiler {
+	return &regexCompiler{
+		rules:     rules,
+		limit:     limit,
+		maxLength: maxLength,
+		minLen:    minLengths(rules),
+		done:      make(map[int]string),
+		visiting:  make(map[int]bool),
+	}
+}
+
+// Compiles the rule into an anchored regular expression, along with the fewest repeats a balanced rule was cut
+// off at (0 when it matches exactly what the rule does for lines up to maxLength)
+//
+// A regular expression with a bounded expansion only misses lines that need more repeats than the limit. With no
+// limit, one is chosen from maxLength.
+func compileRegexp(rules map[int]rule, start, limit, maxLength int) (*regexp.Regexp, int, error) {
+	c := newRegexCompiler(rules, limit, maxLength)
+	expr, err := c.compile(start)
+	if err != nil {
+		return nil, 0, err
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, 0, err
+	}
+	return re, c.cutoff, nil
+}
+
+func (c *regexCompiler) compile(num int) (string, error) {
+	if expr, ok := c.done[num]; ok {
+		return expr, nil
+	}
+	if c.visiting[num] {
+		return "", fmt.Errorf("rule %d refers back to itself in a way that isn't regular", num)
+	}
+	r, ok := c.rules[num]
+	if !ok {
+		return "", fmt.Errorf("rule %d is not defined", num)
+	}
+
+	c.visiting[num] = true
+	defer delete(c.visiting, num)
+
+	var expr string
+	var err error
+	if x, y, shape := c.selfReference(num, r); shape == repeated {
+		expr, err = c.repeat(x)
+	} else if shape == balanced {
+		expr, err = c.balance(x, y)
+	} else {
+		expr, err = c.alternatives(r.anyOf)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.done[num] = expr
+	return expr, nil
+}
+
+type recursionShape int
+
+const (
+	notRecursive recursionShape = iota
+	repeated                    // n: X | X n
+	balanced                    // n: X Y | X n Y
+)
+
+// Recognizes the self referencing shapes the compiler can handle, returning their X and Y parts
+func (c *regexCompiler) selfReference(num int, r rule) (group, group, recursionShape) {
+	if len(r.anyOf) != 2 {
+		return nil, nil, notRecursive
+	}
+	base, recursive := r.anyOf[0], r.anyOf[1]
+	if len(base) > len(recursive) {
+		base, recursive = recursive, base
+	}
+	if len(recursive) != len(base)+1 {
+		return nil, nil, notRecursive
+	}
+
+	// find where the rule refers to itself, the rest must be the base alternative
+	for i, e := range recursive {
+		if e.kind() != otherRule || e.ruleNum() != num {
+			continue
+		}
+		without := append(append(group{}, recursive[:i]...), recursive[i+1:]...)
+		if !sameGroup(without, base) {
+			return nil, nil, notRecursive
+		}
+		switch {
+		case i == 0 || i == len(recursive)-1:
+			return base, nil, repeated
+		case i > 0:
+			return base[:i], base[i:], balanced
+		}
+	}
+	return nil, nil, notRecursive
+}
+
+func sameGroup(a, b group) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *regexCompiler) repeat(x group) (string, error) {
+	expr, err := c.sequence(x)
+	if err != nil {
+		return "", err
+	}
+	return "(?:" + expr + ")+", nil
+}
+
+func (c *regexCompiler) balance(x, y group) (string, error) {
+	xExpr, err := c.sequence(x)
+	if err != nil {
+		return "", err
+	}
+	yExpr, err := c.sequence(y)
+	if err != nil {
+		return "", err
+	}
+
+	// no line up to maxLength has room for more repeats than needed
+	needed := 0
+	per := c.groupMinLen(x) + c.groupMinLen(y)
+	if per > 0 && c.maxLength > 0 {
+		needed = c.maxLength / per
+	}
+	limit := c.limit
+	if limit <= 0 {
+		limit = needed
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	// repeats past the limit aren't matched
+	if per == 0 || c.maxLength <= 0 || limit < needed {
+		if c.cutoff == 0 || limit < c.cutoff {
+			c.cutoff = limit
+		}
+	}
+
+	var alts []string
+	for n := 1; n <= limit; n++ {
+		alts = append(alts, fmt.Sprintf("(?:%s){%d}(?:%s){%d}", xExpr, n, yExpr, n))
+	}
+	return "(?:" + strings.Join(alts, "|") + ")", nil
+}
+
+func (c *regexCompiler) alternatives(groups []group) (string, error) {
+	alts := make([]string, len(groups))
+	for i, g := range groups {
+		expr, err := c.sequence(g)
+		if err != nil {
+			return "", err
+		}
+		alts[i] = expr
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return "(?:" + strings.Join(alts, "|") + ")", nil
+}
+
+func (c *regexCompiler) sequence(g group) (string, error) {
+	var sb strings.Builder
+	for _, e := range g {
+		if e.kind() == literal {
+			sb.WriteString(regexp.QuoteMeta(e.literal()))
+			continue
+		}
+		expr, err := c.compile(e.ruleNum())
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(expr)
+	}
+	return sb.String(), nil
+}
+
+func (c *regexCompiler) groupMinLen(g group) int {
+	total := 0
+	for _, e := range g {
+		if e.kind() == literal {
+			total += len(e.literal())
+			continue
+		}
+		total += c.minLen[e.ruleNum()]
+	}
+	return total
+}
+
+// Finds the length of the shortest line each rule matches, leaving out rules that can't match anything
+func minLengths(rules map[int]rule) map[int]int {
+	best := make(map[int]int)
+	groupLen := func(g group) int {
+		total := 0
+		for _, e := range g {
+			if e.kind() == literal {
+				total += len(e.literal())
+				continue
+			}
+			n, ok := best[e.ruleNum()]
+			if !ok {
+				return math.MaxInt32
+			}
+			total += n
+		}
+		return total
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for num, r := range rules {
+			for _, g := range r.anyOf {
+				n := groupLen(g)
+				if n == math.MaxInt32 {
+					continue
+				}
+				if old, ok := best[num]; !ok || n < old {
+					best[num] = n
+					changed = true
+				}
+			}
+		}
+	}
+	return best
+}
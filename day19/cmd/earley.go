@@ -0,0 +1,119 @@
+package main
+
+import "strings"
+
+// A partly matched rule alternative: the elements before dot matched the line from origin onwards
+type earleyItem struct {
+	rule   int
+	alt    int
+	dot    int
+	origin int
+}
+
+// Recognizes lines with any set of rules, including rules that refer to themselves, using Earley's algorithm
+//
+// For every position in the line, the chart holds the items that could be in progress there. An item
+// either waits for a literal (scanning), waits for another rule (predicting it), or is complete and
+// advances the items that were waiting for its rule.
+type recognizer struct {
+	rules    map[int]rule
+	nullable map[int]bool // rules that can match an empty string
+}
+
+func newRecognizer(rules map[int]rule) *recognizer {
+	return &recognizer{rules: rules, nullable: nullableRules(rules)}
+}
+
+// Finds the rules that can match an empty string, by growing the set until it stops changing
+func nullableRules(rules map[int]rule) map[int]bool {
+	nullable := make(map[int]bool)
+	for changed := true; changed; {
+		changed = false
+		for num, r := range rules {
+			if nullable[num] {
+				continue
+			}
+			for _, g := range r.anyOf {
+				empty := true
+				for _, e := range g {
+					if (e.kind() == literal && e.literal() != "") || (e.kind() == otherRule && !nullable[e.ruleNum()]) {
+						empty = false
+						break
+					}
+				}
+				if empty {
+					nullable[num] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return nullable
+}
+
+// Checks whether the rule matches the whole line
+func (r *recognizer) recognize(line string, start int) bool {
+	chart := make([][]earleyItem, len(line)+1)
+	seen := make([]map[earleyItem]bool, len(line)+1)
+	for i := range seen {
+		seen[i] = make(map[earleyItem]bool)
+	}
+	add := func(pos int, item earleyItem) {
+		if !seen[pos][item] {
+			seen[pos][item] = true
+			chart[pos] = append(chart[pos], item)
+		}
+	}
+
+	for alt := range r.rules[start].anyOf {
+		add(0, earleyItem{rule: start, alt: alt})
+	}
+
+	for pos := 0; pos <= len(line); pos++ {
+		// the chart for this position grows while it is being processed
+		for i := 0; i < len(chart[pos]); i++ {
+			item := chart[pos][i]
+			g := r.rules[item.rule].anyOf[item.alt]
+
+			if item.dot == len(g) {
+				// complete: advance everything that was waiting for this rule
+				for _, waiting := range chart[item.origin] {
+					wg := r.rules[waiting.rule].anyOf[waiting.alt]
+					if waiting.dot < len(wg) && wg[waiting.dot].kind() == otherRule && wg[waiting.dot].ruleNum() == item.rule {
+						waiting.dot++
+						add(pos, waiting)
+					}
+				}
+				continue
+			}
+
+			next := item
+			next.dot++
+			switch e := g[item.dot]; e.kind() {
+			case literal:
+				// scan
+				if lit := e.literal(); strings.HasPrefix(line[pos:], lit) {
+					add(pos+len(lit), next)
+				}
+			case otherRule:
+				// predict
+				num := e.ruleNum()
+				for alt := range r.rules[num].anyOf {
+					add(pos, earleyItem{rule: num, alt: alt, origin: pos})
+				}
+				// a rule that can match nothing may already be complete here
+				if r.nullable[num] {
+					add(pos, next)
+				}
+			}
+		}
+	}
+
+	for _, item := range chart[len(line)] {
+		if item.rule == start && item.origin == 0 && item.dot == len(r.rules[start].anyOf[item.alt]) {
+			return true
+		}
+	}
+	return false
+}
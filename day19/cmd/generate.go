@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+)
+
+// The longest strings that are enumerated, as the number of strings grows exponentially with length
+const maxEnumeratedLength = 24
+
+// Brings every rule up to date one length at a time, as the strings of a length are made of shorter ones
+//
+// Within a length a rule is only revisited when a rule it refers to changed, so rules that match a whole string
+// through other rules (like 8: 42) settle without redoing the rest. The update reports whether the rule changed.
+func growByLength(rules map[int]rule, maxLen int, update func(num, length int) (bool, error)) error {
+	users := make(map[int][]int)
+	for num, r := range rules {
+		for _, g := range r.anyOf {
+			for _, e := range g {
+				if e.kind() == otherRule {
+					users[e.ruleNum()] = append(users[e.ruleNum()], num)
+				}
+			}
+		}
+	}
+
+	nums := sortedRuleNums(rules)
+	for length := 0; length <= maxLen; length++ {
+		queue := append([]int(nil), nums...)
+		queued := make(map[int]bool)
+		for _, num := range nums {
+			queued[num] = true
+		}
+		for len(queue) > 0 {
+			num := queue[0]
+			queue = queue[1:]
+			queued[num] = false
+
+			changed, err := update(num, length)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			for _, user := range users[num] {
+				if !queued[user] {
+					queued[user] = true
+					queue = append(queue, user)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Enumerates the strings each rule matches, up to a length limit
+type generator struct {
+	rules  map[int]rule
+	maxLen int
+	lang   map[int][]map[string]bool // the strings of each length each rule matches
+}
+
+func newGenerator(rules map[int]rule, maxLen int) *generator {
+	g := &generator{rules: rules, maxLen: maxLen, lang: make(map[int][]map[string]bool)}
+	for num := range rules {
+		g.lang[num] = make([]map[string]bool, maxLen+1)
+		for length := range g.lang[num] {
+			g.lang[num][length] = make(map[string]bool)
+		}
+	}
+
+	minLen := minLengths(rules)
+	growByLength(rules, maxLen, func(num, length int) (bool, error) {
+		if n, ok := minLen[num]; !ok || n > length {
+			return false, nil
+		}
+		changed := false
+		for _, grp := range rules[num].anyOf {
+			for _, s := range g.sequences(grp, length) {
+				if !g.lang[num][length][s] {
+					g.lang[num][length][s] = true
+					changed = true
+				}
+			}
+		}
+		return changed, nil
+	})
+	return g
+}
+
+// Finds the strings of a length a sequence of elements matches with what is known of the languages so far
+func (g *generator) sequences(grp group, length int) []string {
+	if len(grp) == 0 {
+		if length == 0 {
+			return []string{""}
+		}
+		return nil
+	}
+
+	e := grp[0]
+	if e.kind() == literal {
+		lit := e.literal()
+		if len(lit) > length {
+			return nil
+		}
+		var result []string
+		for _, rest := range g.sequences(grp[1:], length-len(lit)) {
+			result = append(result, lit+rest)
+		}
+		return result
+	}
+
+	// an undefined rule matches nothing
+	lang := g.lang[e.ruleNum()]
+	var result []string
+	for partLen := 0; partLen < len(lang) && partLen <= length; partLen++ {
+		if len(lang[partLen]) == 0 {
+			continue
+		}
+		rests := g.sequences(grp[1:], length-partLen)
+		for part := range lang[partLen] {
+			for _, rest := range rests {
+				result = append(result, part+rest)
+			}
+		}
+	}
+	return result
+}
+
+// Counts the ways the rule matches strings of each length, for lengths too long to enumerate
+//
+// This is not the number of strings: a string that can be matched two ways is counted twice. The two are the same
+// when no string can be matched two ways, as with the puzzle's rules. It is an error when a rule can match through
+// itself without matching anything more, as it then has endless ways to match.
+func countMatchWays(rules map[int]rule, start, maxLen int) ([]*big.Int, error) {
+	counts := make(map[int][]*big.Int)
+	for num := range rules {
+		counts[num] = make([]*big.Int, maxLen+1)
+		for length := range counts[num] {
+			counts[num][length] = new(big.Int)
+		}
+	}
+
+	// without endless ways to match, no rule is visited more times than there are rules at a length (as in
+	// Bellman-Ford)
+	minLen := minLengths(rules)
+	visits := make(map[int]int)
+	visitsLength := 0
+	err := growByLength(rules, maxLen, func(num, length int) (bool, error) {
+		if n, ok := minLen[num]; !ok || n > length {
+			return false, nil
+		}
+		if length != visitsLength {
+			visits, visitsLength = make(map[int]int), length
+		}
+		if visits[num]++; visits[num] > len(rules)+1 {
+			return false, fmt.Errorf("rule %d has endless ways to match strings of length %d", num, length)
+		}
+
+		total := new(big.Int)
+		for _, grp := range rules[num].anyOf {
+			total.Add(total, sequenceCount(counts, grp, length))
+		}
+		if total.Cmp(counts[num][length]) == 0 {
+			return false, nil
+		}
+		counts[num][length] = total
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if counts[start] == nil {
+		return nil, fmt.Errorf("rule %d is not defined", start)
+	}
+	return counts[start], nil
+}
+
+// Counts the ways a sequence of elements matches strings of a length with the counts known so far
+func sequenceCount(counts map[int][]*big.Int, grp group, length int) *big.Int {
+	if len(grp) == 0 {
+		if length == 0 {
+			return big.NewInt(1)
+		}
+		return new(big.Int)
+	}
+
+	e := grp[0]
+	if e.kind() == literal {
+		if n := len(e.literal()); n <= length {
+			return sequenceCount(counts, grp[1:], length-n)
+		}
+		return new(big.Int)
+	}
+
+	// an undefined rule matches nothing, and most rules only match a few lengths
+	total := new(big.Int)
+	part := counts[e.ruleNum()]
+	for partLen := 0; partLen < len(part) && partLen <= length; partLen++ {
+		if part[partLen].Sign() == 0 {
+			continue
+		}
+		if rest := sequenceCount(counts, grp[1:], length-partLen); rest.Sign() != 0 {
+			total.Add(total, new(big.Int).Mul(part[partLen], rest))
+		}
+	}
+	return total
+}
+
+// Counts the strings of each length the rule matches, indexed by length
+func (g *generator) countByLength(start int) []int {
+	counts := make([]int, g.maxLen+1)
+	for length, strs := range g.lang[start] {
+		counts[length] = len(strs)
+	}
+	return counts
+}
+
+// All the strings the rule matches, shortest first and then in alphabetical order
+func (g *generator) language(start int) []string {
+	var all []string
+	for _, strs := range g.lang[start] {
+		for s := range strs {
+			all = append(all, s)
+		}
+	}
+	sortLanguage(all)
+	return all
+}
+
+func sortLanguage(all []string) {
+	sort.Slice(all, func(i, j int) bool {
+		if len(all[i]) != len(all[j]) {
+			return len(all[i]) < len(all[j])
+		}
+		return all[i] < all[j]
+	})
+}
+
+// Compares the strings two rule sets match, returning those only the first matches and those only the second does
+func diffLanguages(a, b map[int]rule, start, maxLen int) ([]string, []string) {
+	langA := newGenerator(a, maxLen).lang[start]
+	langB := newGenerator(b, maxLen).lang[start]
+	return missingFrom(langA, langB), missingFrom(langB, langA)
+}
+
+// The strings in lang that aren't in other, sorted
+func missingFrom(lang, other []map[string]bool) []string {
+	var missing []string
+	for length, strs := range lang {
+		for s := range strs {
+			if !other[length][s] {
+				missing = append(missing, s)
+			}
+		}
+	}
+	sortLanguage(missing)
+	return missing
+}
+
+// Builds random strings a rule matches by picking random alternatives, without enumerating the language
+type sampler struct {
+	rules  map[int]rule
+	minLen map[int]int
+	rnd    *rand.Rand
+	steps  int // alternatives picked so far for the current string
+}
+
+// Gives up on a string after this many picks, so rules that can loop without matching anything still finish
+const maxSampleSteps = 10000
+
+func newSampler(rules map[int]rule, seed int64) *sampler {
+	return &sampler{rules: rules, minLen: minLengths(rules), rnd: rand.New(rand.NewSource(seed))}
+}
+
+// Builds a random string of at most maxLen that the rule matches
+func (s *sampler) sample(start, maxLen int) (string, error) {
+	if n, ok := s.minLen[start]; !ok || n > maxLen {
+		return "", fmt.Errorf("rule %d matches nothing up to length %d", start, maxLen)
+	}
+	for attempt := 0; attempt < 100; attempt++ {
+		s.steps = 0
+		if str, ok := s.derive(start, maxLen); ok {
+			return str, nil
+		}
+	}
+	return "", fmt.Errorf("rule %d keeps looping without matching anything", start)
+}
+
+// Picks one of the rule's alternatives that still fits in the budget and expands it
+func (s *sampler) derive(num, budget int) (string, bool) {
+	s.steps++
+	if s.steps > maxSampleSteps {
+		return "", false
+	}
+
+	var fits []group
+	for _, grp := range s.rules[num].anyOf {
+		if n, ok := s.groupMinLen(grp); ok && n <= budget {
+			fits = append(fits, grp)
+		}
+	}
+	if len(fits) == 0 {
+		return "", false
+	}
+	grp := fits[s.rnd.Intn(len(fits))]
+
+	// every element leaves enough of the budget for the shortest strings of the ones after it
+	rest, _ := s.groupMinLen(grp)
+	var result string
+	for _, e := range grp {
+		if e.kind() == literal {
+			rest -= len(e.literal())
+			budget -= len(e.literal())
+			result += e.literal()
+			continue
+		}
+		rest -= s.minLen[e.ruleNum()]
+		part, ok := s.derive(e.ruleNum(), budget-rest)
+		if !ok {
+			return "", false
+		}
+		budget -= len(part)
+		result += part
+	}
+	return result, true
+}
+
+func (s *sampler) groupMinLen(grp group) (int, bool) {
+	total := 0
+	for _, e := range grp {
+		if e.kind() == literal {
+			total += len(e.literal())
+			continue
+		}
+		n, ok := s.minLen[e.ruleNum()]
+		if !ok {
+			return 0, false
+		}
+		total += n
+	}
+	return total, true
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"log"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
-var debug = false
-
 type elementKind int
 
 const (
@@ -17,19 +21,19 @@ const (
 	literal
 )
 
+// A part of a rule: a quoted literal such as "a" or "ab", or the number of another rule
 type element string
 
 func (e element) kind() elementKind {
-	switch e {
-	case "a", "b":
+	if len(e) >= 2 && e[0] == '"' && e[len(e)-1] == '"' {
 		return literal
-	default:
-		return otherRule
 	}
+	return otherRule
 }
 
-func (e element) literal() byte {
-	return e[0]
+// The text a literal matches, without its quotes
+func (e element) literal() string {
+	return string(e[1 : len(e)-1])
 }
 
 func (e element) ruleNum() int {
@@ -65,202 +69,284 @@ func (r rule) String() string {
 	return sb.String()
 }
 
+// Splits a rule alternative into its elements, keeping the quotes around literals (which may contain spaces)
 func parseRuleGroup(data string) group {
-	parts := strings.Fields(strings.TrimSpace(strings.ReplaceAll(data, "\"", "")))
-	g := make(group, len(parts))
-
-	for i, p := range parts {
-		g[i] = element(p)
+	var g group
+	for i := 0; i < len(data); {
+		switch {
+		case data[i] == ' ':
+			i++
+		case data[i] == '"':
+			end := strings.IndexByte(data[i+1:], '"')
+			if end < 0 {
+				// an unclosed literal is left for validation to report
+				g = append(g, element(data[i:]))
+				return g
+			}
+			g = append(g, element(data[i:i+end+2]))
+			i += end + 2
+		default:
+			end := strings.IndexByte(data[i:], ' ')
+			if end < 0 {
+				end = len(data) - i
+			}
+			g = append(g, element(data[i:i+end]))
+			i += end
+		}
 	}
-
 	return g
 }
 
-func parseRuleLine(line string) (int, rule) {
-	ruleNumAndData := strings.Split(strings.TrimSpace(line), ":")
-	ruleNum := common.Atoi(ruleNumAndData[0])
+func parseRuleLine(line string) (int, rule, error) {
+	ruleNumAndData := strings.SplitN(strings.TrimSpace(line), ":", 2)
+	if len(ruleNumAndData) != 2 {
+		return 0, rule{}, fmt.Errorf("%q has no \":\" after the rule number", line)
+	}
+	ruleNum, err := strconv.Atoi(strings.TrimSpace(ruleNumAndData[0]))
+	if err != nil {
+		return 0, rule{}, fmt.Errorf("%q is not a rule number", ruleNumAndData[0])
+	}
 	result := rule{}
 
-	groups := strings.Split(strings.TrimSpace(ruleNumAndData[1]), "|")
+	groups := splitAlternatives(strings.TrimSpace(ruleNumAndData[1]))
 	result.anyOf = make([]group, len(groups))
 
 	for i, g := range groups {
 		result.anyOf[i] = parseRuleGroup(g)
 	}
 
-	return ruleNum, result
+	return ruleNum, result, nil
 }
 
-func matchGroup(line string, pos int, g group, rules map[int]rule, depth int) []int {
-
-	if pos == len(line) {
-		if debug {
-			fmt.Printf("\n%sEOL for group %q (%q at pos %d)\n", strings.Repeat("\t", depth), g, line, pos)
-		}
-		return nil
-	}
-
-	if debug {
-		if depth > 50 {
-			panic("too deep")
+// Splits a rule's definition at each "|" that isn't inside a literal
+func splitAlternatives(data string) []string {
+	var alts []string
+	inLiteral := false
+	start := 0
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			inLiteral = !inLiteral
+		case '|':
+			if !inLiteral {
+				alts = append(alts, data[start:i])
+				start = i + 1
+			}
 		}
-		fmt.Printf("\n%smatching %q to group %q (%q at pos %d)\n", strings.Repeat("\t", depth), line[pos:], g, line, pos)
 	}
+	return append(alts, data[start:])
+}
 
-	// base case
-	if len(g) == 1 {
-		switch g[0].kind() {
-		case otherRule:
-			return matchRule2(line, pos, rules, g[0].ruleNum(), depth+1)
-		case literal:
-			if g[0].literal() == line[pos] {
-				return []int{pos + 1}
-			}
+// Checks whether the rule matches the whole line
+func matchRule(line string, rules map[int]rule, ruleNum int) bool {
+	return newRecognizer(rules).recognize(line, ruleNum)
+}
 
-			return nil
-		}
+func main() {
+	printRegexp := flag.Bool("regexp", false, "compile rule 0 into a regular expression, print it and count the messages it matches")
+	generate := flag.Bool("generate", false, fmt.Sprintf("count the strings rule 0 matches of each length, up to -max (past %d, the ways to match are counted instead)", maxEnumeratedLength))
+	list := flag.Bool("list", false, "with -generate, print every string as well as the counts")
+	samples := flag.Int("sample", 0, "print this many random strings rule 0 matches, up to -max long")
+	seed := flag.Int64("seed", 1, "the random seed for -sample")
+	diffWith := flag.String("diff", "", "print the strings up to -max long that rule 0 matches in only one of the input and this rule file")
+	maxLen := flag.Int("max", 0, "the longest string to generate, needed by -generate and -diff (default the longest message for -sample)")
+	part := flag.Int("part", 1, "the rules to use: 1 as given, 2 with the looping rules")
+	limit := flag.Int("limit", 0, "how many times to unroll balanced looping rules (default enough for the longest message)")
+	flag.Parse()
+
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	if (*generate || *diffWith != "") && *maxLen <= 0 {
+		log.Fatal("-generate and -diff need -max, the longest string to consider")
+	}
+	if (*list || *diffWith != "") && *maxLen > maxEnumeratedLength {
+		log.Fatalf("-list and -diff build every string, so -max can be at most %d", maxEnumeratedLength)
+	}
+	rules, messages := loadInputFile(flag.Arg(0))
+	if *maxLen <= 0 {
+		*maxLen = longest(messages)
 	}
 
-	possible := matchGroup(line, pos, g[0:1], rules, depth+1)
+	if !*printRegexp && !*generate && *samples == 0 && *diffWith == "" {
+		fmt.Printf("Part 1: %d\n", countMatches(rules, messages))
+		patchRules(rules, loopingRules)
+		fmt.Printf("Part 2: %d\n", countMatches(rules, messages))
+		return
+	}
 
-	var nextPossible []int
-	for _, p := range possible {
-		next := matchGroup(line, p, g[1:], rules, depth+1)
-		if next != nil {
-			nextPossible = append(nextPossible, next...)
+	if *part == 2 {
+		patchRules(rules, loopingRules)
+	}
+	switch {
+	case *printRegexp:
+		re, cutoff, err := compileRegexp(rules, 0, *limit, longest(messages))
+		common.MustNotError(err)
+		fmt.Println(re)
+		if cutoff > 0 {
+			fmt.Printf("(looping rules are unrolled %d times, longer matches are missed)\n", cutoff)
+		}
+		fmt.Printf("Matches: %d\n", countRegexpMatches(re, messages))
+	case *generate && *maxLen <= maxEnumeratedLength:
+		g := newGenerator(rules, *maxLen)
+		if *list {
+			for _, s := range g.language(0) {
+				fmt.Println(s)
+			}
+		}
+		total := 0
+		for length, count := range g.countByLength(0) {
+			if count > 0 {
+				fmt.Printf("length %d: %d\n", length, count)
+				total += count
+			}
+		}
+		fmt.Printf("Total: %d\n", total)
+	case *generate:
+		fmt.Println("Too long to enumerate, counting the ways to match instead (the number of strings when no string matches two ways)")
+		ways, err := countMatchWays(rules, 0, *maxLen)
+		common.MustNotError(err)
+		total := new(big.Int)
+		for length, count := range ways {
+			if count.Sign() > 0 {
+				fmt.Printf("length %d: %s ways\n", length, count)
+				total.Add(total, count)
+			}
+		}
+		fmt.Printf("Total: %s ways\n", total)
+	case *samples > 0:
+		s := newSampler(rules, *seed)
+		for i := 0; i < *samples; i++ {
+			str, err := s.sample(0, *maxLen)
+			common.MustNotError(err)
+			fmt.Println(str)
+		}
+	case *diffWith != "":
+		other, _ := loadInputFile(*diffWith)
+		if *part == 2 {
+			patchRules(other, loopingRules)
+		}
+		onlyA, onlyB := diffLanguages(rules, other, 0, *maxLen)
+		for _, s := range onlyA {
+			fmt.Printf("< %s\n", s)
+		}
+		for _, s := range onlyB {
+			fmt.Printf("> %s\n", s)
 		}
 	}
-
-	return nextPossible
 }
 
-func matchRule2(line string, pos int, rules map[int]rule, ruleNum, depth int) []int {
-	rule := rules[ruleNum]
-	if debug {
-		if depth > 50 {
-			panic("too deep")
-		}
-		fmt.Printf("\n%smatching %q for rule %d: %q\n", strings.Repeat("\t", depth), line, ruleNum, rule)
+func loadInputFile(path string) (map[int]rule, []string) {
+	file, err := os.Open(path)
+	common.MustNotError(err)
+	defer file.Close()
+	rules, messages, err := loadInput(file)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
 	}
 
-	var possible []int
-	for _, g := range rule.anyOf {
-		np := matchGroup(line, pos, g, rules, depth)
-		possible = append(possible, np...)
+	unused, err := validateRules(rules, 0)
+	if err != nil {
+		log.Fatalf("%s has bad rules:\n%v", path, err)
 	}
-
-	return possible
+	if len(unused) > 0 {
+		log.Printf("%s has rules that rule 0 never uses: %v", path, unused)
+	}
+	return rules, messages
 }
 
-func matchRule(line string, rules map[int]rule, ruleNum int) bool {
-	possibleMatches := matchRule2(line, 0, rules, ruleNum, 0)
-
-	if debug {
-		fmt.Println("possible matches were: ", possibleMatches)
+func longest(messages []string) int {
+	longestLen := 0
+	for _, m := range messages {
+		if len(m) > longestLen {
+			longestLen = len(m)
+		}
 	}
+	return longestLen
+}
 
-	for _, p := range possibleMatches {
-		if p == len(line) {
-			return true
+func countRegexpMatches(re *regexp.Regexp, messages []string) int {
+	matchCount := 0
+	for _, m := range messages {
+		if re.MatchString(m) {
+			matchCount++
 		}
 	}
-
-	return false
+	return matchCount
 }
 
-func main() {
-	fmt.Printf("Part 1: %d\n", part1(common.OpenInputFile()))
-	fmt.Printf("Part 2: %d\n", part2(common.OpenInputFile()))
+// The replacements for rules 8 and 11 in part 2, which make the rules loop
+var loopingRules = []string{
+	"8: 42 | 42 8",
+	"11: 42 31 | 42 11 31",
 }
 
-func part1(reader io.Reader) int {
-	matchCount := 0
+// Loads the rules and the received messages
+func loadInput(reader io.Reader) (map[int]rule, []string, error) {
 	doneRules := false
 	rules := make(map[int]rule)
+	var messages []string
+	var err error
+	lineNum := 0
 	common.ScanLines(reader, func(line string) {
+		lineNum++
+		if err != nil {
+			return
+		}
 		if line == "" {
-			if !doneRules {
-				doneRules = true
-			}
+			doneRules = true
 			return
 		}
 
 		if !doneRules {
-			ruleNum, rule := parseRuleLine(line)
+			ruleNum, rule, ruleErr := parseRuleLine(line)
+			if ruleErr != nil {
+				err = fmt.Errorf("line %d: %w", lineNum, ruleErr)
+				return
+			}
 			rules[ruleNum] = rule
 			return
 		}
 
-		if matchRule(line, rules, 0) {
-			matchCount++
-		}
+		messages = append(messages, line)
 	})
-	return matchCount
+	if err != nil {
+		return nil, nil, err
+	}
+	return rules, messages, nil
 }
 
-func replace11(n int) string {
-	var sb strings.Builder
-	for i := 1; i <= n; i++ {
-		sb.WriteString(strings.Repeat("42 ", i))
-		sb.WriteString(strings.Repeat("31 ", i))
-
-		if i < n {
-			sb.WriteString("| ")
-		}
+// Replaces rules with the ones given as rule lines
+func patchRules(rules map[int]rule, lines []string) {
+	for _, line := range lines {
+		ruleNum, rule, err := parseRuleLine(line)
+		common.MustNotError(err)
+		rules[ruleNum] = rule
 	}
-
-	return sb.String()
 }
 
-func replace8(n int) string {
-	var sb strings.Builder
-	for i := 1; i <= n; i++ {
-		var sb strings.Builder
-		for i := 1; i <= n; i++ {
-			sb.WriteString(strings.Repeat("42 ", i))
-
-			if i < n {
-				sb.WriteString("| ")
-			}
+// Counts the messages that completely match rule 0
+func countMatches(rules map[int]rule, messages []string) int {
+	r := newRecognizer(rules)
+	matchCount := 0
+	for _, m := range messages {
+		if r.recognize(m, 0) {
+			matchCount++
 		}
-
-		return sb.String()
 	}
+	return matchCount
+}
 
-	return sb.String()
+func part1(reader io.Reader) int {
+	rules, messages, err := loadInput(reader)
+	common.MustNotError(err)
+	return countMatches(rules, messages)
 }
 
 func part2(reader io.Reader) int {
-	matchCount := 0
-	doneRules := false
-	rules := make(map[int]rule)
-	common.ScanLines(reader, func(line string) {
-		if line == "" {
-			if !doneRules {
-				doneRules = true
-			}
-			return
-		}
-
-		if strings.HasPrefix(line, "8:") {
-			fmt.Println("replacing 8")
-			line = "8: " + replace8(20)
-		}
-
-		if strings.HasPrefix(line, "11:") {
-			fmt.Println("replacing 11")
-			line = "11: " + replace11(20)
-		}
-
-		if !doneRules {
-			ruleNum, rule := parseRuleLine(line)
-			rules[ruleNum] = rule
-			return
-		}
-
-		if matchRule(line, rules, 0) {
-			matchCount++
-		}
-	})
-	return matchCount
+	rules, messages, err := loadInput(reader)
+	common.MustNotError(err)
+	patchRules(rules, loopingRules)
+	return countMatches(rules, messages)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math/big"
 	"strings"
 	"testing"
 )
@@ -11,20 +12,15 @@ func loadRules(data string, replace bool) map[int]rule {
 	for _, rs := range strings.Split(data, "\n") {
 		rs = strings.TrimSpace(rs)
 		fmt.Println(replace, rs)
-		if replace {
-			if strings.HasPrefix(rs, "8: ") {
-				fmt.Println("Replacing 8!")
-				rs = "8: " + replace8(10)
-			}
-
-			if strings.HasPrefix(rs, "11: ") {
-				fmt.Println("Replacing 11!")
-				rs = "11: " + replace11(10)
-			}
+		rn, r, err := parseRuleLine(rs)
+		if err != nil {
+			panic(err)
 		}
-		rn, r := parseRuleLine(rs)
 		rules[rn] = r
 	}
+	if replace {
+		patchRules(rules, loopingRules)
+	}
 
 	return rules
 }
@@ -165,41 +161,55 @@ func TestPart1(t *testing.T) {
 	testRules(t, false, ruleStr, false, expects)
 }
 
-func TestReplace(t *testing.T) {
-	wanted := "42 "
-	got := replace8(1)
-	if got != wanted {
-		t.Errorf("wanted %q got %q\n", wanted, got)
-	}
-
-	wanted = wanted + "| 42 42 "
-	got = replace8(2)
-	if got != wanted {
-		t.Errorf("wanted %q got %q\n", wanted, got)
-	}
-
-	wanted = wanted + "| 42 42 42 "
-	got = replace8(3)
-	if got != wanted {
-		t.Errorf("wanted %q got %q\n", wanted, got)
-	}
-
-	wanted = "42 31 "
-	got = replace11(1)
-	if got != wanted {
-		t.Errorf("wanted %q got %q\n", wanted, got)
-	}
-
-	wanted = "42 31 | 42 42 31 31 "
-	got = replace11(2)
-	if got != wanted {
-		t.Errorf("wanted %q got %q\n", wanted, got)
-	}
-
-	wanted = "42 31 | 42 42 31 31 | 42 42 42 31 31 31 "
-	got = replace11(3)
-	if got != wanted {
-		t.Errorf("wanted %q got %q\n", wanted, got)
+func TestRecursiveRules(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		rules   string
+		expects []ruleExpect
+	}{
+		{
+			name: "left recursive",
+			rules: `0: 0 1 | 1
+			1: "a"`,
+			expects: []ruleExpect{{"a", true}, {"aaaa", true}, {"", false}, {"ab", false}},
+		},
+		{
+			name: "balanced",
+			rules: `0: 1 0 2 | 1 2
+			1: "a"
+			2: "b"`,
+			expects: []ruleExpect{{"ab", true}, {"aaabbb", true}, {"aabbb", false}, {"abab", false}},
+		},
+		{
+			name: "empty alternatives",
+			rules: `0: 1 2 1
+			1: 3 1 |
+			2: "b"
+			3: "a"`,
+			expects: []ruleExpect{{"b", true}, {"aab", true}, {"baaa", true}, {"aba", true}, {"bb", false}, {"", false}},
+		},
+		{
+			name: "mutually recursive",
+			rules: `0: 1 | 2
+			1: 3 2 | 3
+			2: 4 1 | 4
+			3: "a"
+			4: "b"`,
+			expects: []ruleExpect{{"a", true}, {"abab", true}, {"babab", true}, {"aab", false}},
+		},
+		{
+			name: "undefined rule",
+			rules: `0: 1 | 2
+			1: "a"`,
+			expects: []ruleExpect{{"a", true}, {"b", false}},
+		},
+	} {
+		rules := loadRules(c.rules, false)
+		for _, re := range c.expects {
+			if matched := matchRule(re.line, rules, 0); matched != re.match {
+				t.Errorf("%s: wanted %t got %t for %q\n", c.name, re.match, matched, re.line)
+			}
+		}
 	}
 }
 
@@ -236,7 +246,6 @@ func TestPart2(t *testing.T) {
 	7: 14 5 | 1 21
 	24: 14 1`
 
-	debug = false
 	expects := []ruleExpect{
 		{"bbabbbbaabaabba", true},
 		{"babbbbaabbbbbabbbbbbaabaaabaaa", true},
@@ -280,3 +289,352 @@ func testRules(t *testing.T, fatal bool, rulesStr string, replace bool, expects
 		}
 	}
 }
+
+const exampleRules = `42: 9 14 | 10 1
+9: 14 27 | 1 26
+10: 23 14 | 28 1
+1: "a"
+11: 42 31
+5: 1 14 | 15 1
+19: 14 1 | 14 14
+12: 24 14 | 19 1
+16: 15 1 | 14 14
+31: 14 17 | 1 13
+6: 14 14 | 1 14
+2: 1 24 | 14 4
+0: 8 11
+13: 14 3 | 1 12
+15: 1 | 14
+17: 14 2 | 1 7
+23: 25 1 | 22 14
+28: 16 1
+4: 1 1
+20: 14 14 | 1 15
+3: 5 14 | 16 1
+27: 1 6 | 14 18
+14: "b"
+21: 14 1 | 1 14
+25: 1 1 | 1 14
+22: 14 14
+8: 42
+26: 14 22 | 1 20
+18: 15 15
+7: 14 5 | 1 21
+24: 14 1`
+
+var exampleMessages = []string{
+	"abbbbbabbbaaaababbaabbbbabababbbabbbbbbabaaaa",
+	"bbabbbbaabaabba",
+	"babbbbaabbbbbabbbbbbaabaaabaaa",
+	"aaabbbbbbaaaabaababaabababbabaaabbababababaaa",
+	"bbbbbbbaaaabbbbaaabbabaaa",
+	"bbbababbbbaaaaaaaabbababaaababaabab",
+	"ababaaaaaabaaab",
+	"ababaaaaabbbaba",
+	"baabbaaaabbaaaababbaababb",
+	"abbbbabbbbaaaababbbbbbaaaababb",
+	"aaaaabbaabaaaaababaa",
+	"aaaabbaaaabbaaa",
+	"aaaabbaabbaaaaaaabbbabbbaaabbaabaaa",
+	"babaaabbbaaabaababbaabababaaab",
+	"aabbbbbaabbbaaaaaabbbbbababaaaaabbaaabba",
+}
+
+func TestCompileRegexp(t *testing.T) {
+	for _, c := range []struct {
+		replace bool
+		limit   int
+		cutoff  int
+		matches int
+	}{
+		{replace: false, matches: 3},
+		{replace: true, matches: 12},
+		{replace: true, limit: 1, cutoff: 1, matches: 6},
+		// enough repeats for the longest message
+		{replace: true, limit: 4, matches: 12},
+		{replace: true, limit: 20, matches: 12},
+	} {
+		rules := loadRules(exampleRules, c.replace)
+		re, cutoff, err := compileRegexp(rules, 0, c.limit, longest(exampleMessages))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cutoff != c.cutoff {
+			t.Errorf("wanted a cutoff of %d got %d\n", c.cutoff, cutoff)
+		}
+		if got := countRegexpMatches(re, exampleMessages); got != c.matches {
+			t.Errorf("wanted %d matches got %d\n", c.matches, got)
+		}
+
+		// the regular expression agrees with the recognizer within its limit
+		if c.cutoff == 0 {
+			for _, m := range exampleMessages {
+				if re.MatchString(m) != matchRule(m, rules, 0) {
+					t.Errorf("regexp and matchRule disagree on %q\n", m)
+				}
+			}
+		}
+	}
+}
+
+func TestCompileShapes(t *testing.T) {
+	for _, c := range []struct {
+		rules string
+		expr  string
+		err   bool
+	}{
+		{rules: "0: 1 2 | 2 1\n1: \"a\"\n2: \"b\"", expr: "^(?:ab|ba)$"},
+		{rules: "0: 1 | 1 0\n1: \"a\"", expr: "^(?:a)+$"},
+		{rules: "0: 1 | 0 1\n1: \"a\"", expr: "^(?:a)+$"},
+		{rules: "0: 1 2 | 1 0 2\n1: \"a\"\n2: \"b\"", expr: "^(?:(?:a){1}(?:b){1}|(?:a){2}(?:b){2})$"},
+		{rules: "0: 1 0 0 | 1\n1: \"a\"", err: true},
+		{rules: "0: 1 | 2\n1: 2 | 0\n2: \"a\"", err: true},
+		{rules: "0: 1 3\n1: \"a\"", err: true},
+	} {
+		re, _, err := compileRegexp(loadRules(c.rules, false), 0, 0, 4)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: expected an error got %s\n", c.rules, re)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v\n", c.rules, err)
+			continue
+		}
+		if re.String() != c.expr {
+			t.Errorf("%q: wanted %s got %s\n", c.rules, c.expr, re)
+		}
+	}
+}
+
+func BenchmarkMatchRule(b *testing.B) {
+	rules := loadRules(exampleRules, true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		countMatches(rules, exampleMessages)
+	}
+}
+
+func BenchmarkRegexp(b *testing.B) {
+	rules := loadRules(exampleRules, true)
+	re, _, err := compileRegexp(rules, 0, 0, longest(exampleMessages))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		countRegexpMatches(re, exampleMessages)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for _, c := range []struct {
+		rules  string
+		maxLen int
+		want   []string
+	}{
+		{rules: "0: 1 2 | 2 1\n1: \"a\"\n2: \"b\"", maxLen: 5, want: []string{"ab", "ba"}},
+		{rules: "0: 1 | 1 0\n1: \"a\"", maxLen: 3, want: []string{"a", "aa", "aaa"}},
+		{rules: "0: 1 2 | 1 0 2\n1: \"a\"\n2: \"b\"", maxLen: 7, want: []string{"ab", "aabb", "aaabbb"}},
+		{rules: "0: 1 3\n1: \"a\"", maxLen: 5, want: nil},
+	} {
+		got := newGenerator(loadRules(c.rules, false), c.maxLen).language(0)
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%q: wanted %v got %v\n", c.rules, c.want, got)
+		}
+	}
+}
+
+func TestGeneratedMatch(t *testing.T) {
+	rules := loadRules(exampleRules, true)
+	g := newGenerator(rules, 20)
+	all := g.language(0)
+	counts := g.countByLength(0)
+	if counts[15] != 4096 || counts[20] != 65536 || len(all) != 4096+65536 {
+		t.Errorf("unexpected counts by length %v\n", counts)
+	}
+
+	// no string matches two ways, so there are as many ways to match as strings
+	ways, err := countMatchWays(rules, 0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for length, count := range counts {
+		if ways[length].Int64() != int64(count) {
+			t.Errorf("length %d: %s ways to match %d strings\n", length, ways[length], count)
+		}
+	}
+	// there are too many strings to check them all
+	r := newRecognizer(rules)
+	for i := 0; i < len(all); i += 97 {
+		if !r.recognize(all[i], 0) {
+			t.Fatalf("generated %q but it doesn't match\n", all[i])
+		}
+	}
+
+	// every matching message that is short enough is generated
+	generated := make(map[string]bool)
+	for _, s := range all {
+		generated[s] = true
+	}
+	for _, m := range exampleMessages {
+		if len(m) <= 20 && matchRule(m, rules, 0) && !generated[m] {
+			t.Errorf("%q matches but wasn't generated\n", m)
+		}
+	}
+}
+
+func TestCountMatchWays(t *testing.T) {
+	// 42 and 31 each match 16 strings of 5 characters, and rule 0 matches 42 a times then 31 b times with a > b
+	ways, err := countMatchWays(loadRules(exampleRules, true), 0, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Exp(big.NewInt(16), big.NewInt(9), nil)
+	want.Mul(want, big.NewInt(4))
+	if ways[45].Cmp(want) != 0 || ways[44].Sign() != 0 {
+		t.Errorf("wanted %s ways to match length 45 got %s\n", want, ways[45])
+	}
+
+	// a string that matches two ways is one string
+	ambiguous := loadRules("0: 1 | 2\n1: \"a\"\n2: \"a\"", false)
+	if ways, err := countMatchWays(ambiguous, 0, 1); err != nil || ways[1].Int64() != 2 {
+		t.Errorf("wanted 2 ways to match got %v (%v)\n", ways, err)
+	}
+	if counts := newGenerator(ambiguous, 1).countByLength(0); counts[1] != 1 {
+		t.Errorf("wanted 1 string got %d\n", counts[1])
+	}
+
+	// rules that match through each other still match a few strings
+	looping := loadRules("0: 1 | \"b\"\n1: 0 | \"a\"", false)
+	if got := newGenerator(looping, 3).language(0); strings.Join(got, ",") != "a,b" {
+		t.Errorf("wanted [a b] got %v\n", got)
+	}
+}
+
+func TestSample(t *testing.T) {
+	rules := loadRules(exampleRules, true)
+	s := newSampler(rules, 1)
+	for i := 0; i < 50; i++ {
+		str, err := s.sample(0, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(str) > 40 || !matchRule(str, rules, 0) {
+			t.Errorf("sampled %q which doesn't match in 40 characters\n", str)
+		}
+	}
+
+	if _, err := newSampler(rules, 1).sample(0, 10); err == nil {
+		t.Error("expected an error sampling strings shorter than the rule allows")
+	}
+}
+
+func TestDiffLanguages(t *testing.T) {
+	before := loadRules(exampleRules, false)
+	after := loadRules(exampleRules, true)
+
+	onlyBefore, onlyAfter := diffLanguages(before, after, 0, 15)
+	if len(onlyBefore) != 0 || len(onlyAfter) != 0 {
+		t.Errorf("expected the same strings up to 15 long, got %v and %v\n", onlyBefore, onlyAfter)
+	}
+
+	onlyBefore, onlyAfter = diffLanguages(before, after, 0, 20)
+	if len(onlyBefore) != 0 || len(onlyAfter) == 0 {
+		t.Errorf("expected only the looping rules to match more, got %d and %d\n", len(onlyBefore), len(onlyAfter))
+	}
+	for i := 0; i < len(onlyAfter); i += 97 {
+		if s := onlyAfter[i]; matchRule(s, before, 0) || !matchRule(s, after, 0) {
+			t.Errorf("%q isn't matched only by the looping rules\n", s)
+		}
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	rules := loadRules("0: \"ab\" 1 | \"x y\" | 2\n1: \"c\"\n2: \"|\" \":\" | \"\"", false)
+	for _, c := range []struct {
+		line  string
+		match bool
+	}{
+		{"abc", true},
+		{"x y", true},
+		{"|:", true},
+		{"", true},
+		{"ab", false},
+		{"a", false},
+		{"abcc", false},
+	} {
+		if got := matchRule(c.line, rules, 0); got != c.match {
+			t.Errorf("wanted %t got %t for %q\n", c.match, got, c.line)
+		}
+	}
+
+	re, _, err := compileRegexp(rules, 0, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if re.String() != `^(?:abc|x y|(?:\|:|))$` {
+		t.Errorf("unexpected regexp %s\n", re)
+	}
+
+	got := newGenerator(rules, 5).language(0)
+	if want := []string{"", "|:", "abc", "x y"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("wanted %q got %q\n", want, got)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	for _, c := range []struct {
+		rules  string
+		unused []int
+		errors []string
+	}{
+		{rules: exampleRules, unused: nil},
+		{rules: "0: 1\n1: \"a\"\n2: 1 | 3\n3: \"b\"", unused: []int{2, 3}},
+		{rules: "0: 1 5\n1: \"a\" | 7", errors: []string{
+			"rule 0 refers to rule 5, which is not defined",
+			"rule 1 refers to rule 7, which is not defined",
+		}},
+		{rules: "0: a \"b", errors: []string{
+			"rule 0: \"a\" is neither a rule number nor a quoted literal",
+			"rule 0: the literal \"b is missing its closing quote",
+		}},
+		{rules: "1: \"a\"", errors: []string{"rule 0 is not defined"}},
+	} {
+		unused, err := validateRules(loadRules(c.rules, false), 0)
+		if len(c.errors) > 0 {
+			if err == nil || err.Error() != strings.Join(c.errors, "\n") {
+				t.Errorf("%q: wanted errors %q got %v\n", c.rules, c.errors, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v\n", c.rules, err)
+		}
+		if fmt.Sprint(unused) != fmt.Sprint(c.unused) {
+			t.Errorf("%q: wanted unused %v got %v\n", c.rules, c.unused, unused)
+		}
+	}
+}
+
+func TestBadRuleLines(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		err   string
+	}{
+		{input: "x: \"a\"\n\na", err: "line 1: \"x\" is not a rule number"},
+		{input: "0: 1\n1 \"a\"\n\na", err: "line 2: \"1 \\\"a\\\"\" has no \":\" after the rule number"},
+		{input: "0: 1\n1: \"a\"\n-: 1\n\na", err: "line 3: \"-\" is not a rule number"},
+	} {
+		_, _, err := loadInput(strings.NewReader(c.input))
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%q: wanted error %q got %v\n", c.input, c.err, err)
+		}
+	}
+
+	rules, messages, err := loadInput(strings.NewReader("0: 1\n1: \"a\"\n\na"))
+	if err != nil || len(rules) != 2 || len(messages) != 1 {
+		t.Errorf("unexpected result %v %v %v\n", rules, messages, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Checks that every rule refers only to rules that are defined, returning the rules start never uses
+//
+// All the problems found are reported together, one per line of the error.
+func validateRules(rules map[int]rule, start int) ([]int, error) {
+	var problems []string
+	if _, ok := rules[start]; !ok {
+		problems = append(problems, fmt.Sprintf("rule %d is not defined", start))
+	}
+
+	nums := sortedRuleNums(rules)
+	for _, num := range nums {
+		for _, g := range rules[num].anyOf {
+			for _, e := range g {
+				if problem := checkElement(rules, num, e); problem != "" {
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+
+	used := map[int]bool{start: true}
+	for queue := []int{start}; len(queue) > 0; queue = queue[1:] {
+		for _, g := range rules[queue[0]].anyOf {
+			for _, e := range g {
+				if e.kind() == otherRule && !used[e.ruleNum()] {
+					used[e.ruleNum()] = true
+					queue = append(queue, e.ruleNum())
+				}
+			}
+		}
+	}
+
+	var unused []int
+	for _, num := range nums {
+		if !used[num] {
+			unused = append(unused, num)
+		}
+	}
+	return unused, nil
+}
+
+// Describes what is wrong with an element of a rule, or returns an empty string when nothing is
+func checkElement(rules map[int]rule, num int, e element) string {
+	if e.kind() == literal {
+		return ""
+	}
+	if strings.HasPrefix(string(e), "\"") {
+		return fmt.Sprintf("rule %d: the literal %s is missing its closing quote", num, e)
+	}
+	ref, err := strconv.Atoi(string(e))
+	if err != nil {
+		return fmt.Sprintf("rule %d: %q is neither a rule number nor a quoted literal", num, e)
+	}
+	if _, ok := rules[ref]; !ok {
+		return fmt.Sprintf("rule %d refers to rule %d, which is not defined", num, ref)
+	}
+	return ""
+}
+
+func sortedRuleNums(rules map[int]rule) []int {
+	nums := make([]int, 0, len(rules))
+	for num := range rules {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
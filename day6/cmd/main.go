@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/csv"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -9,53 +12,106 @@ import (
 	common "github.com/torbensky/adventofcode-common"
 )
 
-// Scans the questions file and returns counts
-func scanQuestionsFile(path string) (int, int) {
-	totalUnique, totalEveryone := 0, 0
-	countQuestions := func(token string) {
-		u, e := parseGroup(token)
-		totalUnique += u
-		totalEveryone += e
-	}
-	file := common.OpenInputFile()
-	defer file.Close()
-	common.ScanSplit(file, countQuestions, common.SplitRecordsFunc)
+// A group of people and the questions they answered "yes" to
+type group struct {
+	people    int          // number of people in the group
+	questions map[rune]int // count of people per question
+}
+
+// Loads every group in the questions file
+func loadGroups(reader io.Reader) []group {
+	var groups []group
+	common.ScanSplit(reader, func(token string) {
+		groups = append(groups, parseGroup(token))
+	}, common.SplitRecordsFunc)
 
-	return totalUnique, totalEveryone
+	return groups
 }
 
-func parseGroup(group string) (int, int) {
+func parseGroup(token string) group {
 	// whitespace should separate each person
-	peoplesAnswers := strings.Fields(group)
-	numPeople := len(peoplesAnswers)
-
-	// Find unique questions
-	uniqueQuestions := make(map[rune]int) // count of people per question
-	for i := 0; i < numPeople; i++ {
-		for _, c := range peoplesAnswers[i] {
-			uniqueQuestions[c]++
+	peoplesAnswers := strings.Fields(token)
+
+	g := group{
+		people:    len(peoplesAnswers),
+		questions: make(map[rune]int),
+	}
+	for _, answers := range peoplesAnswers {
+		for _, c := range answers {
+			g.questions[c]++
 		}
 	}
 
-	// Find questions that everyone had
-	totalEveryone := 0
-	for _, count := range uniqueQuestions {
-		if count == numPeople {
-			totalEveryone++
+	return g
+}
+
+// Counts the questions where the number of people who answered satisfies the predicate
+func (g group) countWhere(pred func(answered, people int) bool) int {
+	total := 0
+	for _, count := range g.questions {
+		if pred(count, g.people) {
+			total++
 		}
 	}
-
-	return len(uniqueQuestions), totalEveryone
+	return total
 }
 
+// The queries answering part 1 and part 2
+const defaultQueries = "count(any); count(all)"
+
 func main() {
+	queryText := flag.String("query", "", "semicolon separated queries to run, e.g. \"count(any); count(atleast 3); top questions\"")
+	printCSV := flag.Bool("csv", false, "print the per-group breakdown of the queries (or of both parts without -query) as CSV")
+	flag.Parse()
 
 	// Validate program usage
-	if len(os.Args) != 2 {
+	if flag.NArg() != 1 {
 		log.Fatal("This command accepts only one argument: the path to the input file")
 	}
-	totalUnique, totalEveryone := scanQuestionsFile(os.Args[1])
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+	groups := loadGroups(file)
+
+	if *queryText == "" && !*printCSV {
+		fmt.Printf("Part 1: %d\n", mustParseQuery("count(any)").total(groups).count)
+		fmt.Printf("Part 2: %d\n", mustParseQuery("count(all)").total(groups).count)
+		return
+	}
+
+	if *queryText == "" {
+		// break down the puzzle's own queries
+		*queryText = defaultQueries
+	}
+	queries, err := parseQueries(*queryText)
+	common.MustNotError(err)
+
+	if *printCSV {
+		w := csv.NewWriter(os.Stdout)
+		common.MustNotError(w.WriteAll(breakdown(queries, groups)))
+		return
+	}
+
+	for _, q := range queries {
+		fmt.Printf("%s: %s\n", q, q.total(groups))
+	}
+}
+
+// Builds the per-group breakdown of the query results, one row per group
+func breakdown(queries []query, groups []group) [][]string {
+	header := []string{"group", "people"}
+	for _, q := range queries {
+		header = append(header, q.String())
+	}
+
+	rows := [][]string{header}
+	for i, g := range groups {
+		row := []string{fmt.Sprint(i + 1), fmt.Sprint(g.people)}
+		for _, q := range queries {
+			row = append(row, q.group(g).String())
+		}
+		rows = append(rows, row)
+	}
 
-	fmt.Printf("Part 1: %d\n", totalUnique)
-	fmt.Printf("Part 2: %d\n", totalEveryone)
+	return rows
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	example1 = `abc
+
+a
+b
+c
+
+ab
+ac
+
+a
+a
+a
+a
+
+b`
+)
+
+var conditions = []struct {
+	query string
+	total string
+	group []string
+}{
+	{query: "count(any)", total: "11", group: []string{"3", "3", "3", "1", "1"}},
+	{query: "count(all)", total: "6", group: []string{"3", "0", "1", "1", "1"}},
+	{query: "count(atleast 2)", total: "2", group: []string{"0", "0", "1", "1", "0"}},
+	{query: "count(exactly 1)", total: "9", group: []string{"3", "3", "2", "0", "1"}},
+	{query: "top 2 questions", total: "a:8 b:4", group: []string{"a:1 b:1", "a:1 b:1", "a:2 b:1", "a:4", "b:1"}},
+}
+
+func TestQueries(t *testing.T) {
+	t.Parallel()
+	groups := loadGroups(strings.NewReader(example1))
+	for i, cond := range conditions {
+		q, err := parseQuery(cond.query)
+		if err != nil {
+			t.Fatalf("Example %d: unexpected error %v\n", i+1, err)
+		}
+		if got := q.total(groups).String(); got != cond.total {
+			t.Errorf("Example %d: expected total %s got %s\n", i+1, cond.total, got)
+		}
+		for j, g := range groups {
+			if got := q.group(g).String(); got != cond.group[j] {
+				t.Errorf("Example %d group %d: expected %s got %s\n", i+1, j+1, cond.group[j], got)
+			}
+		}
+	}
+}
+
+func TestBadQueries(t *testing.T) {
+	t.Parallel()
+	for _, text := range []string{"count(some)", "count(all 2)", "count(atleast)", "bottom questions"} {
+		if _, err := parseQuery(text); err == nil {
+			t.Errorf("expected an error for query %q\n", text)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A query over the customs answers of groups
+//
+// Supported queries:
+//
+//	count(any)        questions anyone in the group answered
+//	count(all)        questions everyone in the group answered
+//	count(atleast N)  questions at least N people answered
+//	count(exactly N)  questions exactly N people answered
+//	top questions     questions ranked by how many people answered them
+//	top N questions   the N highest ranked questions
+type query interface {
+	fmt.Stringer
+	group(g group) result        // evaluates the query for a single group
+	total(groups []group) result // evaluates the query over all the groups
+}
+
+// The outcome of a query, either a count or a ranking of questions
+type result struct {
+	count   int
+	ranking []questionCount // only set by ranking queries
+}
+
+type questionCount struct {
+	question rune
+	people   int
+}
+
+func (r result) String() string {
+	if r.ranking == nil {
+		return strconv.Itoa(r.count)
+	}
+
+	parts := make([]string, len(r.ranking))
+	for i, qc := range r.ranking {
+		parts[i] = fmt.Sprintf("%c:%d", qc.question, qc.people)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Counts the questions in each group that match a predicate
+type countQuery struct {
+	text  string
+	match func(answered, people int) bool
+}
+
+func (q countQuery) String() string {
+	return q.text
+}
+
+func (q countQuery) group(g group) result {
+	return result{count: g.countWhere(q.match)}
+}
+
+func (q countQuery) total(groups []group) result {
+	total := 0
+	for _, g := range groups {
+		total += g.countWhere(q.match)
+	}
+	return result{count: total}
+}
+
+// Ranks questions by the number of people who answered them
+type topQuery struct {
+	limit int // 0 means no limit
+}
+
+func (q topQuery) String() string {
+	if q.limit == 0 {
+		return "top questions"
+	}
+	return fmt.Sprintf("top %d questions", q.limit)
+}
+
+func (q topQuery) group(g group) result {
+	return q.rank(g.questions)
+}
+
+func (q topQuery) total(groups []group) result {
+	questions := make(map[rune]int)
+	for _, g := range groups {
+		for c, count := range g.questions {
+			questions[c] += count
+		}
+	}
+	return q.rank(questions)
+}
+
+func (q topQuery) rank(questions map[rune]int) result {
+	ranking := make([]questionCount, 0, len(questions))
+	for c, count := range questions {
+		ranking = append(ranking, questionCount{question: c, people: count})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].people != ranking[j].people {
+			return ranking[i].people > ranking[j].people
+		}
+		return ranking[i].question < ranking[j].question
+	})
+
+	if q.limit > 0 && len(ranking) > q.limit {
+		ranking = ranking[:q.limit]
+	}
+	return result{ranking: ranking}
+}
+
+var (
+	countQueryRegex = regexp.MustCompile(`^count\(\s*(any|all|atleast|exactly)\s*(\d+)?\s*\)$`)
+	topQueryRegex   = regexp.MustCompile(`^top\s+(?:(\d+)\s+)?questions$`)
+)
+
+// Parses a single query
+func parseQuery(text string) (query, error) {
+	text = strings.TrimSpace(text)
+
+	if m := topQueryRegex.FindStringSubmatch(text); m != nil {
+		q := topQuery{}
+		if m[1] != "" {
+			q.limit, _ = strconv.Atoi(m[1])
+		}
+		return q, nil
+	}
+
+	m := countQueryRegex.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf("unrecognized query %q", text)
+	}
+
+	selector, arg := m[1], m[2]
+	switch selector {
+	case "any", "all":
+		if arg != "" {
+			return nil, fmt.Errorf("query %q: %s does not take an argument", text, selector)
+		}
+	default:
+		if arg == "" {
+			return nil, fmt.Errorf("query %q: %s requires a number of people", text, selector)
+		}
+	}
+	n, _ := strconv.Atoi(arg)
+
+	q := countQuery{text: text}
+	switch selector {
+	case "any":
+		q.match = func(answered, people int) bool { return answered > 0 }
+	case "all":
+		q.match = func(answered, people int) bool { return answered == people }
+	case "atleast":
+		q.match = func(answered, people int) bool { return answered >= n }
+	case "exactly":
+		q.match = func(answered, people int) bool { return answered == n }
+	}
+	return q, nil
+}
+
+// Parses a semicolon separated list of queries
+func parseQueries(text string) ([]query, error) {
+	var queries []query
+	for _, part := range strings.Split(text, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		q, err := parseQuery(part)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+func mustParseQuery(text string) query {
+	q, err := parseQuery(text)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
@@ -1,110 +1,60 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"strconv"
-	"strings"
+	"os"
 
 	common "github.com/torbensky/adventofcode-common"
+	"github.com/torbensky/adventofcode2020/day7"
 )
 
-type bagRule struct {
-	bagType  string         // type of outer bag
-	contains map[string]int // types of inner bags + count required
-}
-
 func main() {
-	bagRules := loadRules(common.OpenInputFile())
-
-	fmt.Println()
-	fmt.Printf("Part 1 - Total %d\n\n", calcPart1(bagRules))
-	fmt.Printf("Part 2 - Total %d\n\n", countAllInnerBags(bagRules, "shiny gold"))
-}
-
-func loadRules(reader io.Reader) map[string]*bagRule {
-	bagRules := make(map[string]*bagRule)
-	parseRuleLine := func(line string) {
-		words := strings.Fields(line)
-		outerBag := strings.Join(words[0:2], " ")
+	target := flag.String("bag", "shiny gold", "the bag to search for")
+	dot := flag.Bool("dot", false, "print the bags reachable from the target bag in Graphviz DOT format")
+	flag.Parse()
 
-		newRule := &bagRule{
-			bagType:  outerBag,
-			contains: make(map[string]int),
-		}
-
-		for i := 4; i < len(words); i += 4 {
-			// Check for "no other bags"
-			if words[i] == "no" {
-				break
-			}
-
-			// Find how many bags are required
-			numBags, err := strconv.Atoi(words[i])
-			if err != nil {
-				log.Fatal("can't process bag count")
-			}
-
-			innerBag := strings.Join(words[i+1:i+3], " ")
-			newRule.contains[innerBag] = numBags
-		}
-
-		// Only add rules that are not dead-ends
-		if len(newRule.contains) > 0 {
-			bagRules[outerBag] = newRule
-		}
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
 	}
-	common.ScanLines(reader, parseRuleLine)
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
 
-	return bagRules
-}
-
-func calcPart1(bagRules map[string]*bagRule) int {
-	// Count the total number of ways to have shiny gold bags
-	totalWithShinyGold := 0
-	for bt := range bagRules {
-		if canContain(bagRules, bt, "shiny gold") {
-			totalWithShinyGold++
-		}
+	bagRules := loadRules(file)
+	if !bagRules.Has(*target) {
+		log.Fatalf("there are no rules for %q bags", *target)
 	}
-	return totalWithShinyGold
-}
 
-// Checks whether a given bag is allowed to contain the target bag
-func canContain(rules map[string]*bagRule, outerBag, targetBag string) bool {
-	// base condition, can we go further?
-	if rules[outerBag] == nil {
-		return false // no
+	if *dot {
+		common.MustNotError(bagRules.WriteDOT(os.Stdout, *target))
+		return
 	}
 
-	// Did we find it?
-	if _, ok := rules[outerBag].contains[targetBag]; ok {
-		return true
-	}
+	fmt.Println()
+	fmt.Printf("Part 1 - Total %d\n\n", calcPart1(bagRules, *target))
+	fmt.Printf("Part 2 - Total %d\n\n", countAllInnerBags(bagRules, *target))
+}
 
-	// Maybe an inner bag allows...
-	for bt := range rules[outerBag].contains {
-		if canContain(rules, bt, targetBag) {
-			return true
-		}
+func loadRules(reader io.Reader) *day7.Graph {
+	g, err := day7.LoadGraph(reader)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return g
+}
 
-	// Nope, no inner bags contain it either
-	return false
+// Count the number of bag types that can eventually contain the target bag
+func calcPart1(bagRules *day7.Graph, targetBag string) int {
+	return len(bagRules.Containers(targetBag))
 }
 
 // Count the number of inner bags that must be within the given bag type
-func countAllInnerBags(rules map[string]*bagRule, bagType string) int {
-	// Base condition
-	if rules[bagType] == nil {
-		return 0
-	}
-
-	total := 0
-	for bt, count := range rules[bagType].contains {
-		total += count + count*countAllInnerBags(rules, bt)
-	}
-
+func countAllInnerBags(bagRules *day7.Graph, bagType string) int {
+	total, err := bagRules.CountContents(bagType)
+	common.MustNotError(err)
 	return total
 }
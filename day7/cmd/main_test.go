@@ -39,7 +39,7 @@ func TestPart1(t *testing.T) {
 		reader := strings.NewReader(cond.data)
 		rules := loadRules(reader)
 		want := cond.part1
-		got := calcPart1(rules)
+		got := calcPart1(rules, "shiny gold")
 		if want != got {
 			t.Errorf("Example %d: expected %d got %d\n", i+1, want, got)
 		}
@@ -0,0 +1,290 @@
+package day7
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	common "github.com/torbensky/adventofcode-common"
+)
+
+// Graph is a directed, weighted graph of bag rules
+//
+// An edge from an outer bag to an inner bag with weight N means the outer bag must contain N of the inner bag
+type Graph struct {
+	bags     []string                  // every known bag, in the order they were first seen
+	contents map[string]map[string]int // outer bag -> inner bag -> count
+	holders  map[string]map[string]int // reverse index: inner bag -> outer bag -> count
+}
+
+// NewGraph creates an empty bag graph
+func NewGraph() *Graph {
+	return &Graph{
+		contents: make(map[string]map[string]int),
+		holders:  make(map[string]map[string]int),
+	}
+}
+
+// LoadGraph loads bag rules from an io source
+//
+// Bags that contain "no other bags" are kept as leaves of the graph. Loading stops at the first malformed rule.
+func LoadGraph(reader io.Reader) (*Graph, error) {
+	g := NewGraph()
+	var err error
+	parseRuleLine := func(line string) {
+		words := strings.Fields(line)
+		if err != nil || len(words) == 0 {
+			return
+		}
+		if len(words) < 4 {
+			err = fmt.Errorf("can't process bag rule %q", line)
+			return
+		}
+		outerBag := strings.Join(words[0:2], " ")
+		g.AddBag(outerBag)
+
+		for i := 4; i < len(words); i += 4 {
+			// Check for "no other bags"
+			if words[i] == "no" {
+				break
+			}
+
+			// Find how many bags are required
+			var numBags int
+			numBags, err = strconv.Atoi(words[i])
+			if err != nil || i+3 > len(words) {
+				err = fmt.Errorf("can't process bag count in rule %q", line)
+				return
+			}
+
+			innerBag := strings.Join(words[i+1:i+3], " ")
+			g.AddRule(outerBag, innerBag, numBags)
+		}
+	}
+	common.ScanLines(reader, parseRuleLine)
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// AddBag adds a bag to the graph (if it is not already known)
+func (g *Graph) AddBag(bag string) {
+	if _, ok := g.contents[bag]; ok {
+		return
+	}
+	g.bags = append(g.bags, bag)
+	g.contents[bag] = make(map[string]int)
+	g.holders[bag] = make(map[string]int)
+}
+
+// AddRule records that the outer bag must contain count of the inner bag
+func (g *Graph) AddRule(outer, inner string, count int) {
+	g.AddBag(outer)
+	g.AddBag(inner)
+	g.contents[outer][inner] = count
+	g.holders[inner][outer] = count
+}
+
+// Bags returns every bag in the graph, in the order they were first seen
+func (g *Graph) Bags() []string {
+	return append([]string(nil), g.bags...)
+}
+
+// Has checks whether the bag is known to the graph
+func (g *Graph) Has(bag string) bool {
+	_, ok := g.contents[bag]
+	return ok
+}
+
+// Contents returns the bags directly inside the given bag, and how many of each
+func (g *Graph) Contents(bag string) map[string]int {
+	return g.contents[bag]
+}
+
+// Holders returns the bags that directly contain the given bag, and how many of it they hold
+func (g *Graph) Holders(bag string) map[string]int {
+	return g.holders[bag]
+}
+
+// Containers finds every bag that can eventually contain the target bag
+//
+// It does a single traversal of the reverse index, so each bag is visited at most once
+func (g *Graph) Containers(target string) []string {
+	seen := map[string]bool{target: true}
+	queue := []string{target}
+	var found []string
+	for len(queue) > 0 {
+		bag := queue[0]
+		queue = queue[1:]
+		for outer := range g.holders[bag] {
+			if seen[outer] {
+				continue
+			}
+			seen[outer] = true
+			found = append(found, outer)
+			queue = append(queue, outer)
+		}
+	}
+
+	sort.Strings(found)
+	return found
+}
+
+// CountContents counts the total number of bags that must be inside the given bag
+//
+// Counts are memoized per bag, so shared sub-trees are only counted once
+func (g *Graph) CountContents(bag string) (int, error) {
+	if cycle := g.cycleFrom(bag); cycle != nil {
+		return 0, &CycleError{Path: cycle}
+	}
+
+	memo := make(map[string]int)
+	var count func(bag string) int
+	count = func(bag string) int {
+		if total, ok := memo[bag]; ok {
+			return total
+		}
+		total := 0
+		for inner, n := range g.contents[bag] {
+			total += n + n*count(inner)
+		}
+		memo[bag] = total
+		return total
+	}
+
+	return count(bag), nil
+}
+
+// CycleError reports bag rules that (impossibly) require a bag to contain itself
+type CycleError struct {
+	Path []string // the bags along the cycle, starting and ending with the same bag
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("bag rules contain a cycle: %s", strings.Join(e.Path, " -> "))
+}
+
+// visit states for depth first searches
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+// FindCycle finds a cycle in the bag rules, returning nil when there is none
+//
+// The returned path starts and ends with the same bag
+func (g *Graph) FindCycle() []string {
+	state := make(map[string]int)
+	for _, bag := range g.bags {
+		if cycle := g.findCycle(bag, state, nil); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// finds a cycle reachable from a single bag
+func (g *Graph) cycleFrom(bag string) []string {
+	return g.findCycle(bag, make(map[string]int), nil)
+}
+
+func (g *Graph) findCycle(bag string, state map[string]int, path []string) []string {
+	switch state[bag] {
+	case visited:
+		return nil
+	case visiting:
+		// the cycle is the part of the path since we first entered this bag
+		for i, b := range path {
+			if b == bag {
+				return append(append([]string(nil), path[i:]...), bag)
+			}
+		}
+	}
+
+	state[bag] = visiting
+	path = append(path, bag)
+	for _, inner := range g.sortedContents(bag) {
+		if cycle := g.findCycle(inner, state, path); cycle != nil {
+			return cycle
+		}
+	}
+	state[bag] = visited
+
+	return nil
+}
+
+// TopologicalOrder orders the bags so that every bag comes before all the bags it contains
+func (g *Graph) TopologicalOrder() ([]string, error) {
+	if cycle := g.FindCycle(); cycle != nil {
+		return nil, &CycleError{Path: cycle}
+	}
+
+	// Kahn's algorithm, using the number of holders as the in-degree
+	inDegree := make(map[string]int)
+	var queue []string
+	for _, bag := range g.bags {
+		inDegree[bag] = len(g.holders[bag])
+		if inDegree[bag] == 0 {
+			queue = append(queue, bag)
+		}
+	}
+
+	order := make([]string, 0, len(g.bags))
+	for len(queue) > 0 {
+		bag := queue[0]
+		queue = queue[1:]
+		order = append(order, bag)
+		for _, inner := range g.sortedContents(bag) {
+			inDegree[inner]--
+			if inDegree[inner] == 0 {
+				queue = append(queue, inner)
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// WriteDOT writes the sub-graph reachable from the root bag in Graphviz DOT format
+func (g *Graph) WriteDOT(w io.Writer, root string) error {
+	if !g.Has(root) {
+		return fmt.Errorf("unknown bag %q", root)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph bags {\n")
+	fmt.Fprintf(&sb, "\t%q [style=filled];\n", root)
+
+	seen := map[string]bool{root: true}
+	queue := []string{root}
+	for len(queue) > 0 {
+		bag := queue[0]
+		queue = queue[1:]
+		for _, inner := range g.sortedContents(bag) {
+			fmt.Fprintf(&sb, "\t%q -> %q [label=%d];\n", bag, inner, g.contents[bag][inner])
+			if !seen[inner] {
+				seen[inner] = true
+				queue = append(queue, inner)
+			}
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// the inner bags of a bag, in a stable order
+func (g *Graph) sortedContents(bag string) []string {
+	inner := make([]string, 0, len(g.contents[bag]))
+	for b := range g.contents[bag] {
+		inner = append(inner, b)
+	}
+	sort.Strings(inner)
+	return inner
+}
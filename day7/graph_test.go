@@ -0,0 +1,116 @@
+package day7
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const example1 = `light red bags contain 1 bright white bag, 2 muted yellow bags.
+dark orange bags contain 3 bright white bags, 4 muted yellow bags.
+bright white bags contain 1 shiny gold bag.
+muted yellow bags contain 2 shiny gold bags, 9 faded blue bags.
+shiny gold bags contain 1 dark olive bag, 2 vibrant plum bags.
+dark olive bags contain 3 faded blue bags, 4 dotted black bags.
+vibrant plum bags contain 5 faded blue bags, 6 dotted black bags.
+faded blue bags contain no other bags.
+dotted black bags contain no other bags.`
+
+func mustLoadGraph(t *testing.T, rules string) *Graph {
+	g, err := LoadGraph(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestBadRules(t *testing.T) {
+	for _, rules := range []string{
+		"shiny gold bags",
+		"shiny gold bags contain two dark red bags.",
+		"shiny gold bags contain 2 dark",
+	} {
+		if _, err := LoadGraph(strings.NewReader(rules)); err == nil {
+			t.Errorf("expected an error for %q\n", rules)
+		}
+	}
+}
+
+func TestLeafBags(t *testing.T) {
+	g := mustLoadGraph(t, example1)
+	if len(g.Bags()) != 9 {
+		t.Errorf("expected 9 bags got %d\n", len(g.Bags()))
+	}
+	if !g.Has("faded blue") || len(g.Contents("faded blue")) != 0 {
+		t.Errorf("expected faded blue to be a leaf bag")
+	}
+}
+
+func TestContainers(t *testing.T) {
+	g := mustLoadGraph(t, example1)
+	want := []string{"bright white", "dark orange", "light red", "muted yellow"}
+	if got := g.Containers("shiny gold"); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %v got %v\n", want, got)
+	}
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	g := mustLoadGraph(t, example1)
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	position := make(map[string]int)
+	for i, bag := range order {
+		position[bag] = i
+	}
+	for _, outer := range g.Bags() {
+		for inner := range g.Contents(outer) {
+			if position[outer] > position[inner] {
+				t.Errorf("expected %s to come before %s in %v\n", outer, inner, order)
+			}
+		}
+	}
+}
+
+func TestCycle(t *testing.T) {
+	g := mustLoadGraph(t, `shiny gold bags contain 1 dark red bag.
+dark red bags contain 2 dark orange bags, 1 dim tan bag.
+dim tan bags contain no other bags.
+dark orange bags contain 1 shiny gold bag.`)
+
+	want := []string{"shiny gold", "dark red", "dark orange", "shiny gold"}
+	if got := g.FindCycle(); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected cycle %v got %v\n", want, got)
+	}
+
+	var cycleErr *CycleError
+	if _, err := g.CountContents("dark red"); !errors.As(err, &cycleErr) {
+		t.Errorf("expected a cycle error got %v\n", err)
+	}
+	if _, err := g.TopologicalOrder(); !errors.As(err, &cycleErr) {
+		t.Errorf("expected a cycle error got %v\n", err)
+	}
+	if n, err := g.CountContents("dim tan"); err != nil || n != 0 {
+		t.Errorf("expected 0 got %d (%v)\n", n, err)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := mustLoadGraph(t, example1)
+	var sb strings.Builder
+	if err := g.WriteDOT(&sb, "vibrant plum"); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph bags {
+	"vibrant plum" [style=filled];
+	"vibrant plum" -> "dotted black" [label=6];
+	"vibrant plum" -> "faded blue" [label=5];
+}
+`
+	if got := sb.String(); want != got {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
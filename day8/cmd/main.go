@@ -1,121 +1,80 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"strconv"
-	"strings"
+	"os"
 
 	common "github.com/torbensky/adventofcode-common"
+	"github.com/torbensky/adventofcode2020/day8"
 )
 
-type operator string
-
-// types of operations
-const (
-	nopOp = operator("nop")
-	accOp = operator("acc")
-	jmpOp = operator("jmp")
-)
-
-// Represents an instruction
-type instruction struct {
-	op  operator // the type of operation
-	arg int      // the argument for the operation
-}
-
 func main() {
-	program := loadProgram(common.OpenInputFile())
-
-	_, acc := executeProgram(program)
-	fmt.Printf("Part 1 - Result %d\n\n", acc)
-	fmt.Printf("Part 2 - Result %d\n", fixProgram(program))
-}
+	trace := flag.Bool("trace", false, "print a trace of every instruction executed in part 1")
+	showFixes := flag.Bool("fixes", false, "print every candidate fix for part 2, with a diff of the patched program")
+	debug := flag.Bool("debug", false, "start an interactive debugger for the program")
+	disasm := flag.Bool("disasm", false, "print an annotated listing of the program")
+	flag.Parse()
+
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+
+	program, err := day8.LoadProgram(file)
+	common.MustNotError(err)
+
+	switch {
+	case *disasm:
+		fmt.Print(day8.Disassemble(program))
+		return
+	case *debug:
+		day8.NewDebugger(program, os.Stdout).Run(os.Stdin)
+		return
+	}
 
-// Fixes the program according to Part 2
-func fixProgram(instructions []instruction) int {
-	for i, inst := range instructions {
-		var new, old operator
-		switch inst.op {
-		case jmpOp:
-			new, old = nopOp, jmpOp
-		case nopOp:
-			new, old = jmpOp, nopOp
-		default:
-			continue
-		}
+	vm := day8.NewVM(program)
+	vm.Trace(*trace)
+	status, err := vm.RunUntilHalt()
+	common.MustNotError(err)
+	for _, entry := range vm.TraceLog() {
+		fmt.Println(entry)
+	}
+	fmt.Printf("Part 1 - Result %d (%s)\n\n", vm.Acc, status)
 
-		completes, acc := executePatch(instructions, i, new, old)
-		if completes {
-			return acc
+	if *showFixes {
+		fixes, err := day8.FindFixes(program)
+		common.MustNotError(err)
+		for _, fix := range fixes {
+			fmt.Println(fix)
+			fmt.Println(fix.Diff(program))
 		}
 	}
 
-	return -1
+	acc, err := fixProgram(program)
+	common.MustNotError(err)
+	fmt.Printf("Part 2 - Result %d\n", acc)
 }
 
-// Patches the program and executes that, returning the result
-func executePatch(instructions []instruction, patchIdx int, newOp, oldOp operator) (bool, int) {
-	instructions[patchIdx].op = newOp
-	looped, acc := executeProgram(instructions)
-	instructions[patchIdx].op = oldOp
-	return looped, acc
+// Runs the program until it stops, returning why it stopped and the value left in the accumulator
+func executeProgram(program day8.Program) (day8.Status, int, error) {
+	vm := day8.NewVM(program)
+	status, err := vm.RunUntilHalt()
+	return status, vm.Acc, err
 }
 
-// executes a program, halting if an infinite loop is detected
-// returns true/false depending on whether a loop was found and the value left in the accumulator
-func executeProgram(instructions []instruction) (bool, int) {
-	acc := 0
-	i := 0
-	executed := make(map[int]struct{})
-	for i < len(instructions) {
-
-		// Check if we already executed this line
-		if _, ok := executed[i]; ok {
-			return false, acc // yup - loop alert!
-		}
-		executed[i] = struct{}{} // remember we executed this line
-
-		// Execute the instruction
-		switch instructions[i].op {
-		case jmpOp:
-			i += instructions[i].arg
-		case accOp:
-			acc += instructions[i].arg
-			i++
-		case nopOp:
-			i++
-		default:
-			log.Fatalf("unknown instruction %s encountered on line %d", instructions[i].op, i)
-		}
+// Fixes the program according to Part 2
+func fixProgram(program day8.Program) (int, error) {
+	fixes, err := day8.FindFixes(program)
+	if err != nil {
+		return 0, err
 	}
-
-	return true, acc
-}
-
-// Loads a program from some data stream
-func loadProgram(reader io.Reader) []instruction {
-
-	var instructions []instruction
-
-	parseLine := func(line string) {
-
-		fields := strings.Fields(line)
-		instruction := instruction{
-			// NOTE: in the real world, probably should validate this input. But meh for this :P
-			op: operator(fields[0]),
-		}
-
-		// parse out the argument
-		numStr := fields[1]
-		val, err := strconv.Atoi(numStr)
-		common.MustNotError(err)
-		instruction.arg = val
-
-		instructions = append(instructions, instruction)
+	if len(fixes) == 0 {
+		return 0, fmt.Errorf("no single jmp/nop patch makes the program halt")
 	}
-	common.ScanLines(reader, parseLine)
-
-	return instructions
+	return fixes[0].Acc, nil
 }
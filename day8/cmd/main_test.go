@@ -3,6 +3,8 @@ package main
 import (
 	"strings"
 	"testing"
+
+	"github.com/torbensky/adventofcode2020/day8"
 )
 
 const (
@@ -29,20 +31,33 @@ func TestPart1(t *testing.T) {
 	t.Parallel()
 	for i, cond := range conditions {
 		reader := strings.NewReader(cond.data)
-		prog := loadProgram(reader)
-		_, got := executeProgram(prog)
+		prog, err := day8.LoadProgram(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, got, err := executeProgram(prog)
+		if err != nil || status.Reason != day8.InfiniteLoop {
+			t.Errorf("Example %d: expected an infinite loop got %s (%v)\n", i+1, status, err)
+		}
 		want := cond.part1
 		if want != got {
 			t.Errorf("Example %d: expected %d got %d\n", i+1, want, got)
 		}
 	}
 }
+
 func TestPart2(t *testing.T) {
 	t.Parallel()
 	for i, cond := range conditions {
 		reader := strings.NewReader(cond.data)
-		prog := loadProgram(reader)
-		got := fixProgram(prog)
+		prog, err := day8.LoadProgram(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fixProgram(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
 		want := cond.part2
 		if want != got {
 			t.Errorf("Example %d: expected %d got %d\n", i+1, want, got)
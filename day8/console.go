@@ -0,0 +1,355 @@
+package day8
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	common "github.com/torbensky/adventofcode-common"
+)
+
+// Operator is the type of operation an instruction performs
+type Operator string
+
+// types of operations
+const (
+	Nop = Operator("nop")
+	Acc = Operator("acc")
+	Jmp = Operator("jmp")
+)
+
+// Instruction is a single line of a boot program
+type Instruction struct {
+	Op  Operator // the type of operation
+	Arg int      // the argument for the operation
+}
+
+func (inst Instruction) String() string {
+	return fmt.Sprintf("%s %+d", inst.Op, inst.Arg)
+}
+
+// Program is a list of instructions
+type Program []Instruction
+
+// Clone copies the program, so the copy can be patched without changing the original
+func (p Program) Clone() Program {
+	return append(Program(nil), p...)
+}
+
+// LoadProgram loads a program from some data stream
+func LoadProgram(reader io.Reader) (Program, error) {
+	var program Program
+	var err error
+	lineNum := 0
+	parseLine := func(line string) {
+		lineNum++
+		if err != nil || strings.TrimSpace(line) == "" {
+			return
+		}
+
+		var inst Instruction
+		inst, err = ParseInstruction(line)
+		if err != nil {
+			err = fmt.Errorf("line %d: %w", lineNum, err)
+			return
+		}
+		program = append(program, inst)
+	}
+	common.ScanLines(reader, parseLine)
+
+	return program, err
+}
+
+// ParseInstruction parses a single instruction such as "jmp -3"
+func ParseInstruction(text string) (Instruction, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return Instruction{}, fmt.Errorf("expected an operation and an argument, got %q", text)
+	}
+
+	arg, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Instruction{}, fmt.Errorf("bad argument %q: %w", fields[1], err)
+	}
+
+	return Instruction{Op: Operator(fields[0]), Arg: arg}, nil
+}
+
+// Registers holds the state of the console's CPU
+type Registers struct {
+	IP  int // instruction pointer
+	Acc int // accumulator
+}
+
+// OpFunc executes an instruction's operation on the VM
+//
+// It is responsible for moving the instruction pointer
+type OpFunc func(vm *VM, arg int) error
+
+// OpTable maps each operator to its implementation
+type OpTable map[Operator]OpFunc
+
+// DefaultOps returns the operations of the handheld game console
+func DefaultOps() OpTable {
+	return OpTable{
+		Nop: func(vm *VM, arg int) error {
+			vm.IP++
+			return nil
+		},
+		Acc: func(vm *VM, arg int) error {
+			vm.Acc += arg
+			vm.IP++
+			return nil
+		},
+		Jmp: func(vm *VM, arg int) error {
+			vm.IP += arg
+			return nil
+		},
+	}
+}
+
+// Reason describes why the VM stopped running
+type Reason int
+
+// reasons the VM stops
+const (
+	Running      Reason = iota // has not stopped
+	Halted                     // stopped by moving just past the last instruction
+	InfiniteLoop               // stopped before running an instruction a second time
+	OutOfBounds                // stopped by jumping outside of the program
+	Breakpoint                 // paused on a breakpoint
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Running:
+		return "running"
+	case Halted:
+		return "halted"
+	case InfiniteLoop:
+		return "infinite loop"
+	case OutOfBounds:
+		return "ip out of bounds"
+	case Breakpoint:
+		return "breakpoint"
+	}
+	return fmt.Sprintf("Reason(%d)", int(r))
+}
+
+// Status is the state the VM is in after running
+type Status struct {
+	Reason Reason
+	IP     int // the instruction pointer when the VM stopped
+}
+
+func (s Status) String() string {
+	switch s.Reason {
+	case Running, Halted:
+		return s.Reason.String()
+	}
+	return fmt.Sprintf("%s at ip %d", s.Reason, s.IP)
+}
+
+// Stopped checks whether the VM can no longer run
+func (s Status) Stopped() bool {
+	return s.Reason == Halted || s.Reason == InfiniteLoop || s.Reason == OutOfBounds
+}
+
+// TraceEntry records the execution of a single instruction
+type TraceEntry struct {
+	Step   int         // the number of instructions executed before this one
+	Inst   Instruction // the instruction that was executed
+	Before Registers   // the registers before the instruction
+	After  Registers   // the registers after the instruction
+}
+
+func (e TraceEntry) String() string {
+	return fmt.Sprintf("%5d  ip=%-4d %-8s acc=%d -> %d", e.Step, e.Before.IP, e.Inst, e.Before.Acc, e.After.Acc)
+}
+
+// VM runs boot programs for the handheld game console
+type VM struct {
+	Registers
+
+	program     Program
+	ops         OpTable
+	executed    []bool // which instructions have been executed
+	steps       int    // the number of instructions executed
+	breakpoints map[int]bool
+	tracing     bool
+	trace       []TraceEntry
+}
+
+// NewVM creates a VM for a copy of the program, using the default operations
+func NewVM(program Program) *VM {
+	return &VM{
+		program:     program.Clone(),
+		ops:         DefaultOps(),
+		executed:    make([]bool, len(program)),
+		breakpoints: make(map[int]bool),
+	}
+}
+
+// Program returns the program loaded in the VM
+func (vm *VM) Program() Program {
+	return vm.program
+}
+
+// Steps returns the number of instructions executed so far
+func (vm *VM) Steps() int {
+	return vm.steps
+}
+
+// Executed checks whether the instruction at ip has been executed
+func (vm *VM) Executed(ip int) bool {
+	return ip >= 0 && ip < len(vm.executed) && vm.executed[ip]
+}
+
+// Register adds (or replaces) the implementation of an operator
+func (vm *VM) Register(op Operator, fn OpFunc) {
+	vm.ops[op] = fn
+}
+
+// Patch replaces the instruction at ip
+func (vm *VM) Patch(ip int, inst Instruction) error {
+	if ip < 0 || ip >= len(vm.program) {
+		return fmt.Errorf("can't patch ip %d: outside of the program", ip)
+	}
+	vm.program[ip] = inst
+	return nil
+}
+
+// SetBreakpoint pauses Run before the instruction at ip is executed
+func (vm *VM) SetBreakpoint(ip int) {
+	vm.breakpoints[ip] = true
+}
+
+// ClearBreakpoint removes a breakpoint
+func (vm *VM) ClearBreakpoint(ip int) {
+	delete(vm.breakpoints, ip)
+}
+
+// HasBreakpoint checks whether a breakpoint is set at ip
+func (vm *VM) HasBreakpoint(ip int) bool {
+	return vm.breakpoints[ip]
+}
+
+// Trace turns the trace recorder on or off
+func (vm *VM) Trace(enabled bool) {
+	vm.tracing = enabled
+}
+
+// TraceLog returns the recorded trace of every instruction executed while tracing
+func (vm *VM) TraceLog() []TraceEntry {
+	return vm.trace
+}
+
+// Reset restores the VM to its initial state, keeping the program, operations and breakpoints
+func (vm *VM) Reset() {
+	vm.Registers = Registers{}
+	vm.executed = make([]bool, len(vm.program))
+	vm.steps = 0
+	vm.trace = nil
+}
+
+// Rewind undoes every instruction executed since the given step, using the recorded trace
+//
+// The trace must have been recording since the VM started. Patches made to the program are not undone
+func (vm *VM) Rewind(step int) error {
+	if step < 0 || step > vm.steps {
+		return fmt.Errorf("can't rewind to step %d: only %d steps have been executed", step, vm.steps)
+	}
+	if len(vm.trace) != vm.steps {
+		return fmt.Errorf("can't rewind: the trace was not recorded for every step")
+	}
+	if step == vm.steps {
+		return nil
+	}
+
+	for _, entry := range vm.trace[step:] {
+		vm.executed[entry.Before.IP] = false
+	}
+	vm.Registers = vm.trace[step].Before
+	vm.trace = vm.trace[:step]
+	vm.steps = step
+	return nil
+}
+
+// Status checks whether the VM can execute the next instruction
+func (vm *VM) Status() Status {
+	switch {
+	case vm.IP == len(vm.program):
+		return Status{Reason: Halted, IP: vm.IP}
+	case vm.IP < 0 || vm.IP > len(vm.program):
+		return Status{Reason: OutOfBounds, IP: vm.IP}
+	case vm.executed[vm.IP]:
+		return Status{Reason: InfiniteLoop, IP: vm.IP}
+	}
+	return Status{Reason: Running, IP: vm.IP}
+}
+
+// Step executes a single instruction
+//
+// When the VM can't execute the next instruction, nothing is executed and the reason is returned
+func (vm *VM) Step() (Status, error) {
+	if status := vm.Status(); status.Stopped() {
+		return status, nil
+	}
+
+	inst := vm.program[vm.IP]
+	fn, ok := vm.ops[inst.Op]
+	if !ok {
+		return Status{Reason: Running, IP: vm.IP}, fmt.Errorf("unknown instruction %q at ip %d", inst.Op, vm.IP)
+	}
+
+	before := vm.Registers
+	vm.executed[vm.IP] = true
+	if err := fn(vm, inst.Arg); err != nil {
+		return Status{Reason: Running, IP: before.IP}, fmt.Errorf("ip %d: %w", before.IP, err)
+	}
+
+	if vm.tracing {
+		vm.trace = append(vm.trace, TraceEntry{Step: vm.steps, Inst: inst, Before: before, After: vm.Registers})
+	}
+	vm.steps++
+
+	return vm.Status(), nil
+}
+
+// Run executes instructions until the VM stops or reaches a breakpoint
+//
+// A breakpoint on the very first instruction is ignored, so that Run can continue from a breakpoint
+func (vm *VM) Run() (Status, error) {
+	first := true
+	return vm.RunUntil(func(vm *VM) bool {
+		if first {
+			first = false
+			return false
+		}
+		return vm.breakpoints[vm.IP]
+	})
+}
+
+// RunUntilHalt executes instructions until the VM stops, ignoring breakpoints
+func (vm *VM) RunUntilHalt() (Status, error) {
+	return vm.RunUntil(func(vm *VM) bool { return false })
+}
+
+// RunUntil executes instructions until the VM stops or the condition is true
+//
+// The condition is checked before each instruction. When it stops the VM, the status reason is Breakpoint
+func (vm *VM) RunUntil(cond func(vm *VM) bool) (Status, error) {
+	for {
+		status := vm.Status()
+		if status.Stopped() {
+			return status, nil
+		}
+		if cond(vm) {
+			return Status{Reason: Breakpoint, IP: vm.IP}, nil
+		}
+		if _, err := vm.Step(); err != nil {
+			return vm.Status(), err
+		}
+	}
+}
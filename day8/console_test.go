@@ -0,0 +1,122 @@
+package day8
+
+import (
+	"strings"
+	"testing"
+)
+
+const example1 = `nop +0
+acc +1
+jmp +4
+acc +3
+jmp -3
+acc -99
+acc +1
+jmp -4
+acc +6`
+
+func loadExample(t *testing.T) Program {
+	program, err := LoadProgram(strings.NewReader(example1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func TestTermination(t *testing.T) {
+	program := loadExample(t)
+
+	conditions := []struct {
+		ip     int
+		patch  Instruction
+		status Status
+		acc    int
+	}{
+		{ip: 0, patch: Instruction{Nop, 0}, status: Status{InfiniteLoop, 1}, acc: 5},
+		{ip: 7, patch: Instruction{Nop, -4}, status: Status{Halted, 9}, acc: 8},
+		{ip: 2, patch: Instruction{Jmp, 20}, status: Status{OutOfBounds, 22}, acc: 1},
+		{ip: 0, patch: Instruction{Jmp, -1}, status: Status{OutOfBounds, -1}, acc: 0},
+	}
+
+	for i, cond := range conditions {
+		vm := NewVM(program)
+		if err := vm.Patch(cond.ip, cond.patch); err != nil {
+			t.Fatal(err)
+		}
+		status, err := vm.RunUntilHalt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != cond.status || vm.Acc != cond.acc {
+			t.Errorf("Example %d: expected %s acc=%d got %s acc=%d\n", i+1, cond.status, cond.acc, status, vm.Acc)
+		}
+	}
+
+	// patches must not change the original program
+	if program[7].Op != Jmp {
+		t.Errorf("patching the VM changed the original program")
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	vm := NewVM(loadExample(t))
+	vm.SetBreakpoint(4)
+
+	status, err := vm.Run()
+	if err != nil || status != (Status{Breakpoint, 4}) {
+		t.Fatalf("expected breakpoint at ip 4 got %s (%v)\n", status, err)
+	}
+	if vm.Acc != 5 {
+		t.Errorf("expected acc 5 at the breakpoint got %d\n", vm.Acc)
+	}
+
+	status, err = vm.Run()
+	if err != nil || status != (Status{InfiniteLoop, 1}) {
+		t.Fatalf("expected infinite loop at ip 1 got %s (%v)\n", status, err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	vm := NewVM(loadExample(t))
+	vm.Trace(true)
+	if _, err := vm.RunUntilHalt(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ips []int
+	for _, entry := range vm.TraceLog() {
+		ips = append(ips, entry.Before.IP)
+	}
+	want := []int{0, 1, 2, 6, 7, 3, 4}
+	if len(ips) != len(want) || vm.Steps() != len(want) {
+		t.Fatalf("expected trace %v got %v\n", want, ips)
+	}
+	for i := range want {
+		if ips[i] != want[i] {
+			t.Fatalf("expected trace %v got %v\n", want, ips)
+		}
+	}
+}
+
+func TestCustomOps(t *testing.T) {
+	program, err := LoadProgram(strings.NewReader("acc +2\nmul +5\nacc +1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVM(program)
+	if _, err := vm.RunUntilHalt(); err == nil {
+		t.Fatal("expected an error for an unknown instruction")
+	}
+
+	vm = NewVM(program)
+	vm.Register("mul", func(vm *VM, arg int) error {
+		vm.Acc *= arg
+		vm.IP++
+		return nil
+	})
+	status, err := vm.RunUntilHalt()
+	if err != nil || status.Reason != Halted || vm.Acc != 11 {
+		t.Errorf("expected halted with acc 11 got %s acc=%d (%v)\n", status, vm.Acc, err)
+	}
+}
@@ -0,0 +1,318 @@
+package day8
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const debuggerHelp = `commands:
+  step [n]              execute the next n instructions (default 1)
+  continue              run until the program stops or a breakpoint or watch triggers
+  break <ip|op>         break before the instruction at ip, or before any instruction with that operation
+  delete <ip|op>        remove a breakpoint
+  watch acc             break whenever the accumulator changes
+  unwatch acc           stop watching the accumulator
+  list [ip]             print the instructions around ip (default the current ip)
+  regs                  print the registers and the status of the program
+  patch <ip> <op> <arg> replace the instruction at ip
+  rewind <step>         go back to the state before the given step was executed
+  back [n]              undo the last n steps (default 1)
+  history [n]           print the last n executed instructions (default 10)
+  disasm                print an annotated listing of the whole program
+  reset                 restart the program from the beginning
+  help                  print this message
+  quit                  leave the debugger
+`
+
+// Debugger is an interactive debugger for boot programs
+type Debugger struct {
+	vm         *VM
+	out        io.Writer
+	opBreaks   map[Operator]bool
+	watchAcc   bool
+	listRadius int
+}
+
+// NewDebugger creates a debugger for a copy of the program
+func NewDebugger(program Program, out io.Writer) *Debugger {
+	vm := NewVM(program)
+	vm.Trace(true) // the trace is the history used for rewinding
+	return &Debugger{
+		vm:         vm,
+		out:        out,
+		opBreaks:   make(map[Operator]bool),
+		listRadius: 3,
+	}
+}
+
+// VM returns the VM being debugged
+func (d *Debugger) VM() *VM {
+	return d.vm
+}
+
+// Run reads commands from the reader until it is exhausted or the quit command is given
+func (d *Debugger) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(d.out, "(day8) ")
+	for scanner.Scan() {
+		if quit := d.Exec(scanner.Text()); quit {
+			return
+		}
+		fmt.Fprint(d.out, "(day8) ")
+	}
+	fmt.Fprintln(d.out)
+}
+
+// Exec executes a single debugger command, returning true when the debugger should quit
+func (d *Debugger) Exec(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	cmd, args := fields[0], fields[1:]
+	var err error
+	switch cmd {
+	case "s", "step":
+		err = d.step(args)
+	case "c", "continue":
+		err = d.cont()
+	case "b", "break":
+		err = d.setBreak(args, true)
+	case "d", "delete":
+		err = d.setBreak(args, false)
+	case "watch", "unwatch":
+		if len(args) != 1 || args[0] != "acc" {
+			err = fmt.Errorf("usage: %s acc", cmd)
+			break
+		}
+		d.watchAcc = cmd == "watch"
+	case "l", "list":
+		err = d.list(args)
+	case "r", "regs":
+		d.printRegs()
+	case "patch":
+		err = d.patch(args)
+	case "rewind":
+		err = d.rewind(args)
+	case "back":
+		err = d.back(args)
+	case "history":
+		err = d.history(args)
+	case "disasm":
+		fmt.Fprint(d.out, Disassemble(d.vm.Program()))
+	case "reset":
+		d.vm.Reset()
+		d.printRegs()
+	case "h", "help":
+		fmt.Fprint(d.out, debuggerHelp)
+	case "q", "quit", "exit":
+		return true
+	default:
+		err = fmt.Errorf("unknown command %q (try help)", cmd)
+	}
+
+	if err != nil {
+		fmt.Fprintf(d.out, "error: %v\n", err)
+	}
+	return false
+}
+
+// parses an optional count argument
+func countArg(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad count %q", args[0])
+	}
+	return n, nil
+}
+
+func (d *Debugger) step(args []string) error {
+	n, err := countArg(args, 1)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		status, err := d.vm.Step()
+		if err != nil {
+			return err
+		}
+		if status.Stopped() {
+			break
+		}
+	}
+	d.printCurrent()
+	return nil
+}
+
+func (d *Debugger) cont() error {
+	acc := d.vm.Acc
+	first := true
+	status, err := d.vm.RunUntil(func(vm *VM) bool {
+		if first {
+			first = false
+			return false
+		}
+		if d.watchAcc && vm.Acc != acc {
+			fmt.Fprintf(d.out, "acc changed: %d -> %d\n", acc, vm.Acc)
+			return true
+		}
+		return vm.HasBreakpoint(vm.IP) || d.opBreaks[vm.program[vm.IP].Op]
+	})
+	if err != nil {
+		return err
+	}
+
+	if status.Stopped() {
+		fmt.Fprintf(d.out, "program stopped: %s (acc %d)\n", status, d.vm.Acc)
+		return nil
+	}
+	d.printCurrent()
+	return nil
+}
+
+func (d *Debugger) setBreak(args []string, set bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected an ip or an operation")
+	}
+
+	ip, err := strconv.Atoi(args[0])
+	if err != nil {
+		op := Operator(args[0])
+		if _, ok := d.vm.ops[op]; !ok {
+			return fmt.Errorf("unknown operation %q", op)
+		}
+		if set {
+			d.opBreaks[op] = true
+		} else {
+			delete(d.opBreaks, op)
+		}
+		return nil
+	}
+
+	if ip < 0 || ip >= len(d.vm.Program()) {
+		return fmt.Errorf("ip %d is outside of the program", ip)
+	}
+	if set {
+		d.vm.SetBreakpoint(ip)
+	} else {
+		d.vm.ClearBreakpoint(ip)
+	}
+	return nil
+}
+
+func (d *Debugger) list(args []string) error {
+	ip := d.vm.IP
+	if len(args) > 0 {
+		var err error
+		if ip, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("bad ip %q", args[0])
+		}
+	}
+
+	fmt.Fprint(d.out, disassemble(d.vm.Program(), ip-d.listRadius, ip+d.listRadius+1, d.vm.IP))
+	return nil
+}
+
+func (d *Debugger) patch(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: patch <ip> <op> <arg>")
+	}
+	ip, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad ip %q", args[0])
+	}
+	inst, err := ParseInstruction(args[1] + " " + args[2])
+	if err != nil {
+		return err
+	}
+	if err := d.vm.Patch(ip, inst); err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "patched ip %d: %s\n", ip, inst)
+	return nil
+}
+
+func (d *Debugger) rewind(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: rewind <step>")
+	}
+	step, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad step %q", args[0])
+	}
+	if err := d.vm.Rewind(step); err != nil {
+		return err
+	}
+	d.printCurrent()
+	return nil
+}
+
+func (d *Debugger) back(args []string) error {
+	n, err := countArg(args, 1)
+	if err != nil {
+		return err
+	}
+	step := d.vm.Steps() - n
+	if step < 0 {
+		step = 0
+	}
+	if err := d.vm.Rewind(step); err != nil {
+		return err
+	}
+	d.printCurrent()
+	return nil
+}
+
+func (d *Debugger) history(args []string) error {
+	n, err := countArg(args, 10)
+	if err != nil {
+		return err
+	}
+	trace := d.vm.TraceLog()
+	if n < len(trace) {
+		trace = trace[len(trace)-n:]
+	}
+	for _, entry := range trace {
+		fmt.Fprintln(d.out, entry)
+	}
+	return nil
+}
+
+func (d *Debugger) printRegs() {
+	fmt.Fprintf(d.out, "ip=%d acc=%d steps=%d status=%s\n", d.vm.IP, d.vm.Acc, d.vm.Steps(), d.vm.Status())
+
+	var breaks []string
+	for ip := range d.vm.breakpoints {
+		breaks = append(breaks, fmt.Sprint(ip))
+	}
+	for op := range d.opBreaks {
+		breaks = append(breaks, string(op))
+	}
+	if len(breaks) > 0 {
+		sort.Strings(breaks)
+		fmt.Fprintf(d.out, "breakpoints: %s\n", strings.Join(breaks, ", "))
+	}
+	if d.watchAcc {
+		fmt.Fprintln(d.out, "watching: acc")
+	}
+}
+
+// prints the instruction about to be executed
+func (d *Debugger) printCurrent() {
+	status := d.vm.Status()
+	if status.Reason != Running {
+		fmt.Fprintf(d.out, "program stopped: %s (acc %d)\n", status, d.vm.Acc)
+		return
+	}
+	fmt.Fprintf(d.out, "step %d acc=%d\n", d.vm.Steps(), d.vm.Acc)
+	fmt.Fprint(d.out, disassemble(d.vm.Program(), d.vm.IP, d.vm.IP+1, d.vm.IP))
+}
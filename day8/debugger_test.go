@@ -0,0 +1,66 @@
+package day8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	want := `       0: nop +0
+       1: acc +1     ; <- from 4
+       2: jmp +4     ; -> 6
+       3: acc +3     ; <- from 7
+       4: jmp -3     ; -> 1, back-edge
+       5: acc -99
+       6: acc +1     ; <- from 2
+       7: jmp -4     ; -> 3, back-edge
+       8: acc +6
+`
+	if got := Disassemble(loadExample(t)); want != got {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	var out strings.Builder
+	d := NewDebugger(loadExample(t), &out)
+
+	script := []struct {
+		cmd string
+		ip  int
+		acc int
+	}{
+		{cmd: "break jmp", ip: 0, acc: 0},
+		{cmd: "continue", ip: 2, acc: 1},
+		{cmd: "delete jmp", ip: 2, acc: 1},
+		{cmd: "watch acc", ip: 2, acc: 1},
+		{cmd: "continue", ip: 7, acc: 2},
+		{cmd: "unwatch acc", ip: 7, acc: 2},
+		{cmd: "step 2", ip: 4, acc: 5},
+		{cmd: "back 3", ip: 6, acc: 1},
+		{cmd: "rewind 1", ip: 1, acc: 0},
+		{cmd: "patch 7 nop -4", ip: 1, acc: 0},
+		{cmd: "break 8", ip: 1, acc: 0},
+		{cmd: "continue", ip: 8, acc: 2},
+		{cmd: "continue", ip: 9, acc: 8},
+	}
+
+	for _, s := range script {
+		if quit := d.Exec(s.cmd); quit {
+			t.Fatalf("%q: unexpected quit", s.cmd)
+		}
+		if d.VM().IP != s.ip || d.VM().Acc != s.acc {
+			t.Fatalf("%q: expected ip=%d acc=%d got ip=%d acc=%d\n%s", s.cmd, s.ip, s.acc, d.VM().IP, d.VM().Acc, out.String())
+		}
+	}
+
+	if !strings.Contains(out.String(), "program stopped: halted (acc 8)") {
+		t.Errorf("expected the program to halt, got:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "error") {
+		t.Errorf("unexpected error, got:\n%s", out.String())
+	}
+	if !d.Exec("quit") {
+		t.Errorf("expected quit to end the debugger")
+	}
+}
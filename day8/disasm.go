@@ -0,0 +1,77 @@
+package day8
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Disassemble produces an annotated listing of the program
+//
+// Each jmp shows where it lands, jumps that go backwards (and so may loop) are marked as back-edges,
+// and every jump target lists the instructions that jump to it
+func Disassemble(program Program) string {
+	return disassemble(program, 0, len(program), -1)
+}
+
+// disassembles the instructions in [from, to), marking the current instruction pointer
+func disassemble(program Program, from, to, current int) string {
+	// find where every jump comes from
+	jumpsTo := make(map[int][]int)
+	for ip, inst := range program {
+		if inst.Op == Jmp {
+			target := ip + inst.Arg
+			jumpsTo[target] = append(jumpsTo[target], ip)
+		}
+	}
+
+	if from < 0 {
+		from = 0
+	}
+	if to > len(program) {
+		to = len(program)
+	}
+
+	var sb strings.Builder
+	for ip := from; ip < to; ip++ {
+		inst := program[ip]
+
+		marker := "  "
+		if ip == current {
+			marker = "=>"
+		}
+		line := fmt.Sprintf("%s %5d: %-9s", marker, ip, inst)
+
+		var notes []string
+		if inst.Op == Jmp {
+			target := ip + inst.Arg
+			switch {
+			case target == len(program):
+				notes = append(notes, "-> end")
+			case target < 0 || target > len(program):
+				notes = append(notes, fmt.Sprintf("-> %d (out of bounds)", target))
+			default:
+				notes = append(notes, fmt.Sprintf("-> %d", target))
+			}
+			if inst.Arg <= 0 {
+				notes = append(notes, "back-edge")
+			}
+		}
+		if sources := jumpsTo[ip]; len(sources) > 0 {
+			sort.Ints(sources)
+			names := make([]string, len(sources))
+			for i, src := range sources {
+				names[i] = fmt.Sprint(src)
+			}
+			notes = append(notes, "<- from "+strings.Join(names, ", "))
+		}
+
+		if len(notes) > 0 {
+			line += "  ; " + strings.Join(notes, ", ")
+		}
+		sb.WriteString(strings.TrimRight(line, " "))
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,150 @@
+package day8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fix is a single jmp/nop flip that makes a looping program halt
+type Fix struct {
+	IP       int         // the instruction to flip
+	Original Instruction // the instruction before the flip
+	Patched  Instruction // the instruction after the flip
+	Acc      int         // the value left in the accumulator when the patched program halts
+}
+
+func (f Fix) String() string {
+	return fmt.Sprintf("ip %d: %s -> %s (acc %d)", f.IP, f.Original, f.Patched, f.Acc)
+}
+
+// Apply returns a patched copy of the program
+func (f Fix) Apply(program Program) Program {
+	patched := program.Clone()
+	patched[f.IP] = f.Patched
+	return patched
+}
+
+// Diff shows the patched instruction along with a few surrounding lines of the program
+func (f Fix) Diff(program Program) string {
+	const context = 2
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ ip %d @@\n", f.IP)
+	for ip := f.IP - context; ip <= f.IP+context; ip++ {
+		if ip < 0 || ip >= len(program) {
+			continue
+		}
+		if ip == f.IP {
+			fmt.Fprintf(&sb, "-%5d: %s\n", ip, f.Original)
+			fmt.Fprintf(&sb, "+%5d: %s\n", ip, f.Patched)
+			continue
+		}
+		fmt.Fprintf(&sb, " %5d: %s\n", ip, program[ip])
+	}
+	return sb.String()
+}
+
+// flip swaps jmp and nop instructions, reporting false for any other instruction
+func flip(inst Instruction) (Instruction, bool) {
+	switch inst.Op {
+	case Jmp:
+		inst.Op = Nop
+	case Nop:
+		inst.Op = Jmp
+	default:
+		return inst, false
+	}
+	return inst, true
+}
+
+// successor finds the instruction that runs after the instruction at ip
+func successor(ip int, inst Instruction) int {
+	if inst.Op == Jmp {
+		return ip + inst.Arg
+	}
+	return ip + 1
+}
+
+// ControlFlow builds the control-flow graph of the program
+//
+// Every instruction has exactly one successor, so the graph is a list of the successor of each instruction.
+// The program halts when it reaches len(program). Only the default operations are supported.
+func ControlFlow(program Program) ([]int, error) {
+	succ := make([]int, len(program))
+	for ip, inst := range program {
+		switch inst.Op {
+		case Nop, Acc, Jmp:
+			succ[ip] = successor(ip, inst)
+		default:
+			return nil, fmt.Errorf("can't analyze unknown instruction %q at ip %d", inst.Op, ip)
+		}
+	}
+	return succ, nil
+}
+
+// accToEnd finds, for every instruction that eventually halts, how much the accumulator changes from there to the end
+//
+// It walks the control-flow graph backwards from the end of the program, so it visits each instruction once.
+// Instructions that can't reach the end of the program are missing from the result.
+func accToEnd(program Program, succ []int) map[int]int {
+	// reverse edges: instruction -> instructions that run right before it
+	preds := make([][]int, len(program)+1)
+	for ip, next := range succ {
+		if next >= 0 && next <= len(program) {
+			preds[next] = append(preds[next], ip)
+		}
+	}
+
+	result := map[int]int{len(program): 0}
+	queue := []int{len(program)}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, ip := range preds[next] {
+			acc := result[next]
+			if program[ip].Op == Acc {
+				acc += program[ip].Arg
+			}
+			result[ip] = acc
+			queue = append(queue, ip)
+		}
+	}
+
+	return result
+}
+
+// FindFixes finds every single jmp/nop flip that makes the program halt, in linear time
+//
+// Only instructions on the original execution path can change what the program does. Flipping one of them fixes
+// the program when its new successor can reach the end of the unpatched program. A program that already halts
+// has no fixes.
+func FindFixes(program Program) ([]Fix, error) {
+	succ, err := ControlFlow(program)
+	if err != nil {
+		return nil, err
+	}
+	toEnd := accToEnd(program, succ)
+	if _, halts := toEnd[0]; halts {
+		return nil, nil
+	}
+
+	var fixes []Fix
+	executed := make([]bool, len(program))
+	acc := 0
+	for ip := 0; ip >= 0 && ip < len(program) && !executed[ip]; ip = succ[ip] {
+		executed[ip] = true
+
+		inst := program[ip]
+		if patched, ok := flip(inst); ok {
+			if rest, halts := toEnd[successor(ip, patched)]; halts {
+				fixes = append(fixes, Fix{IP: ip, Original: inst, Patched: patched, Acc: acc + rest})
+			}
+		}
+
+		if inst.Op == Acc {
+			acc += inst.Arg
+		}
+	}
+
+	return fixes, nil
+}
@@ -0,0 +1,92 @@
+package day8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindFixes(t *testing.T) {
+	program := loadExample(t)
+	fixes, err := FindFixes(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixes) != 1 {
+		t.Fatalf("expected 1 fix got %v\n", fixes)
+	}
+
+	fix := fixes[0]
+	if fix.IP != 7 || fix.Patched != (Instruction{Nop, -4}) || fix.Acc != 8 {
+		t.Errorf("expected ip 7 nop -4 with acc 8 got %s\n", fix)
+	}
+
+	// the reported accumulator must match actually running the patched program
+	vm := NewVM(fix.Apply(program))
+	status, err := vm.RunUntilHalt()
+	if err != nil || status.Reason != Halted || vm.Acc != fix.Acc {
+		t.Errorf("expected the patched program to halt with acc %d got %s acc=%d (%v)\n", fix.Acc, status, vm.Acc, err)
+	}
+	if program[7].Op != Jmp {
+		t.Errorf("finding fixes changed the original program")
+	}
+
+	want := `@@ ip 7 @@
+     5: acc -99
+     6: acc +1
+-    7: jmp -4
++    7: nop -4
+     8: acc +6
+`
+	if got := fix.Diff(program); want != got {
+		t.Errorf("expected diff:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFindFixesMatchesBruteForce(t *testing.T) {
+	program, err := LoadProgram(strings.NewReader(`nop +2
+jmp +3
+jmp -1
+acc +5
+jmp -3
+nop -1
+acc +7`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixes, err := FindFixes(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[int]int)
+	for _, fix := range fixes {
+		found[fix.IP] = fix.Acc
+	}
+
+	// the only fixes are the ones on the original path that really halt
+	for ip, inst := range program {
+		patched, ok := flip(inst)
+		if !ok {
+			continue
+		}
+		vm := NewVM(program)
+		vm.Patch(ip, patched)
+		status, _ := vm.RunUntilHalt()
+		acc, isFix := found[ip]
+		if (status.Reason == Halted) != isFix {
+			t.Errorf("ip %d: brute force status %s, analyzer fix %t\n", ip, status, isFix)
+		} else if isFix && acc != vm.Acc {
+			t.Errorf("ip %d: expected acc %d got %d\n", ip, vm.Acc, acc)
+		}
+	}
+}
+
+func TestFindFixesHaltingProgram(t *testing.T) {
+	program, err := LoadProgram(strings.NewReader("nop +0\nacc +1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixes, err := FindFixes(program); err != nil || len(fixes) != 0 {
+		t.Errorf("expected no fixes got %v (%v)\n", fixes, err)
+	}
+}
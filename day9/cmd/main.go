@@ -1,78 +1,195 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"log"
+	"os"
 	"strconv"
 
 	common "github.com/torbensky/adventofcode-common"
 )
 
 func main() {
-	nums := loadNumbers(common.OpenInputFile())
+	preamble := flag.Int("preamble", 25, "the number of previous numbers each number must be a sum of")
+	flag.Parse()
 
-	fmt.Printf("Part 1 - Result %d\n\n", part1(nums, 25))
-	fmt.Printf("Part 2 - Result %d\n", part2(nums, 14144619))
+	// Validate program usage
+	if flag.NArg() != 1 {
+		log.Fatal("This command accepts only one argument: the path to the input file")
+	}
+	if *preamble < 2 {
+		log.Fatal("the preamble needs at least 2 numbers")
+	}
+	file, err := os.Open(flag.Arg(0))
+	common.MustNotError(err)
+	defer file.Close()
+
+	// Analyze the numbers as they are streamed in, keeping them around for part 2
+	var nums []int
+	var invalid []invalidNumber
+	a := newAnalyzer(*preamble)
+	scanNumbers(file, func(n int) {
+		nums = append(nums, n)
+		if !a.push(n) {
+			invalid = append(invalid, invalidNumber{index: len(nums) - 1, value: n})
+		}
+	})
+
+	if len(invalid) == 0 {
+		log.Fatal("every number is valid")
+	}
+	for _, inv := range invalid {
+		fmt.Printf("Invalid number %d at index %d\n", inv.value, inv.index)
+	}
+	fmt.Println()
+
+	fmt.Printf("Part 1 - Result %d\n\n", invalid[0].value)
+	fmt.Printf("Part 2 - Result %d\n", part2(nums, invalid[0].value))
 }
 
-func part2(nums []int, value int) int {
-	for i := 0; i < len(nums); i++ {
-		sum := 0
-		smallest := nums[i]
-		largest := nums[i]
-		for j := i; j < len(nums); j++ {
-			if smallest > nums[j] {
-				smallest = nums[j]
-			}
-			if largest < nums[j] {
-				largest = nums[j]
-			}
-			sum += nums[j]
-			if sum == value {
-				return smallest + largest
+// A number that is not the sum of two of the numbers before it
+type invalidNumber struct {
+	index int // position in the stream
+	value int
+}
+
+// Checks a stream of numbers against a sliding window of the numbers before them
+//
+// The analyzer keeps the window in a ring buffer, along with a multiset of the sums of every pair in the window.
+// Checking a number is a single lookup in the multiset, and moving the window along costs O(preamble)
+type analyzer struct {
+	window []int       // ring buffer of the last preamble numbers
+	sums   map[int]int // sum -> how many pairs in the window add up to it
+	count  int         // how many numbers have been pushed
+}
+
+func newAnalyzer(preamble int) *analyzer {
+	return &analyzer{
+		window: make([]int, preamble),
+		sums:   make(map[int]int),
+	}
+}
+
+// Checks whether the value is the sum of two different numbers in the window
+func (a *analyzer) valid(n int) bool {
+	return a.sums[n] > 0
+}
+
+// Adds the next number in the stream, reporting whether it is valid
+//
+// The numbers in the preamble are always valid
+func (a *analyzer) push(n int) bool {
+	preamble := len(a.window)
+	valid := a.count < preamble || a.valid(n)
+
+	slot := a.count % preamble
+	filled := a.count
+	if filled > preamble {
+		filled = preamble
+	}
+
+	// Remove the pairs of the number that falls out of the window
+	if a.count >= preamble {
+		old := a.window[slot]
+		for i := 0; i < preamble; i++ {
+			if i == slot {
+				continue
 			}
-			if sum > value {
-				break
+			sum := old + a.window[i]
+			a.sums[sum]--
+			if a.sums[sum] == 0 {
+				delete(a.sums, sum)
 			}
 		}
 	}
-	return -1
+
+	// Add the pairs of the new number
+	for i := 0; i < filled; i++ {
+		if i == slot {
+			continue
+		}
+		a.sums[n+a.window[i]]++
+	}
+	a.window[slot] = n
+	a.count++
+
+	return valid
 }
 
-func part1(nums []int, preamble int) int {
-	for i := preamble; i < len(nums); i++ {
-		if !hasPastNThatSum(nums[i-preamble:i], preamble, nums[i]) {
-			return nums[i]
+// Finds every number that is not the sum of two of the preamble numbers before it
+func findInvalid(nums []int, preamble int) []invalidNumber {
+	var invalid []invalidNumber
+	a := newAnalyzer(preamble)
+	for i, n := range nums {
+		if !a.push(n) {
+			invalid = append(invalid, invalidNumber{index: i, value: n})
 		}
 	}
+	return invalid
+}
 
-	return -1
+func part1(nums []int, preamble int) int {
+	invalid := findInvalid(nums, preamble)
+	if len(invalid) == 0 {
+		return -1
+	}
+	return invalid[0].value
 }
 
-func hasPastNThatSum(nums []int, n int, target int) bool {
-	for j := 0; j < n; j++ {
-		for q := 0; q < n; q++ {
-			// Don't allow adding to self
-			if q == j {
-				continue
-			}
+// Finds a contiguous range of at least two numbers that add up to the value
+//
+// Uses two pointers over the numbers, which assumes none of them are negative.
+// Returns the start and (exclusive) end of the range
+func findContiguousSum(nums []int, value int) (int, int, bool) {
+	start, sum := 0, 0
+	for end := 0; end < len(nums); end++ {
+		sum += nums[end]
+		for sum > value && start < end {
+			sum -= nums[start]
+			start++
+		}
+		if sum == value && end > start {
+			return start, end + 1, true
+		}
+	}
+	return 0, 0, false
+}
 
-			if target == nums[j]+nums[q] {
-				return true
-			}
+func part2(nums []int, value int) int {
+	start, end, ok := findContiguousSum(nums, value)
+	if !ok {
+		return -1
+	}
+
+	smallest, largest := nums[start], nums[start]
+	for _, n := range nums[start:end] {
+		if smallest > n {
+			smallest = n
+		}
+		if largest < n {
+			largest = n
 		}
 	}
-	return false
+	return smallest + largest
 }
 
-func loadNumbers(reader io.Reader) []int {
-	var nums []int
+// Scans a stream of numbers, one per line
+func scanNumbers(reader io.Reader, fn func(n int)) {
 	parseLine := func(line string) {
 		val, err := strconv.Atoi(line)
 		common.MustNotError(err)
-		nums = append(nums, val)
+		fn(val)
 	}
 	common.ScanLines(reader, parseLine)
+}
+
+func loadNumbers(reader io.Reader) []int {
+	var nums []int
+	scanNumbers(reader, func(n int) {
+		nums = append(nums, n)
+	})
 
 	return nums
 }
@@ -61,3 +61,44 @@ func TestPart2(t *testing.T) {
 		}
 	}
 }
+
+func TestFindInvalid(t *testing.T) {
+	t.Parallel()
+	nums := loadNumbers(strings.NewReader(example1))
+	nums = append(nums, 1, 2000, 2001)
+
+	want := []invalidNumber{{index: 14, value: 127}, {index: 20, value: 1}, {index: 21, value: 2000}}
+	got := findInvalid(nums, 5)
+	if len(got) != len(want) {
+		t.Fatalf("expected %v got %v\n", want, got)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("expected %v got %v\n", want, got)
+		}
+	}
+}
+
+func TestAnalyzerMatchesBruteForce(t *testing.T) {
+	t.Parallel()
+	nums := []int{3, 3, 6, 1, 9, 9, 18, 4, 10, 27, 5, 5, 10, 20, 2}
+	for preamble := 2; preamble < 6; preamble++ {
+		a := newAnalyzer(preamble)
+		for i, n := range nums {
+			want := true
+			if i >= preamble {
+				want = false
+				for j := i - preamble; j < i; j++ {
+					for k := j + 1; k < i; k++ {
+						if nums[j]+nums[k] == n {
+							want = true
+						}
+					}
+				}
+			}
+			if got := a.push(n); want != got {
+				t.Errorf("preamble %d index %d: expected %t got %t\n", preamble, i, want, got)
+			}
+		}
+	}
+}